@@ -0,0 +1,248 @@
+package dhcp4
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	serverPort = 67
+	clientPort = 68
+
+	initialRetransmit = time.Second * 4
+	maxRetransmit     = time.Second * 64
+	readSlice         = time.Millisecond * 500
+
+	// Renewal is not attempted sooner, unless lease expires before
+	minRenewalTime   = time.Minute
+	defaultLeaseTime = time.Hour
+)
+
+var ErrNak = errors.New("dhcp_nak")
+
+type Lease struct {
+	IP            net.IP
+	Mask          net.IPMask
+	Router        net.IP
+	DNS           []net.IP
+	DomainName    string
+	Server        net.IP
+	LeaseTime     time.Duration
+	RenewalTime   time.Duration
+	RebindingTime time.Duration
+	Acquired      time.Time
+}
+
+// Client is DHCPv4 client bound to single interface. It uses UDP socket bound to device,
+// so replies are broadcast by server until address is assigned.
+type Client struct {
+	Interface *net.Interface
+	HostName  string
+	conn      net.PacketConn
+}
+
+func NewClient(netInterface string) (client *Client, e error) {
+	var netIface *net.Interface
+	if netIface, e = net.InterfaceByName(netInterface); e != nil {
+		return
+	}
+	listenConfig := net.ListenConfig{Control: func(network, address string, rawConn syscall.RawConn) (e error) {
+		if err := rawConn.Control(func(fd uintptr) {
+			if e = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); e != nil {
+				return
+			}
+			if e = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1); e != nil {
+				return
+			}
+			e = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, netInterface)
+		}); err != nil {
+			e = err
+		}
+		return
+	}}
+	client = &Client{Interface: netIface}
+	client.HostName, _ = os.Hostname()
+	if client.conn, e = listenConfig.ListenPacket(context.Background(), "udp4", fmt.Sprintf("0.0.0.0:%d", clientPort)); e != nil {
+		client = nil
+	}
+	return
+}
+
+func (self *Client) Close() error {
+	return self.conn.Close()
+}
+
+// Acquire runs DISCOVER/OFFER/REQUEST/ACK exchange until lease is acquired or ctx is done.
+func (self *Client) Acquire(ctx context.Context) (lease *Lease, e error) {
+	for {
+		discover := self.newPacket(MessageDiscover)
+		var offer *Packet
+		if offer, e = self.exchange(ctx, discover, broadcastAddress(), MessageOffer); e != nil {
+			return
+		}
+		request := self.newPacket(MessageRequest)
+		request.XID = discover.XID
+		request.Options[OptionRequestedIP] = offer.YIAddr.To4()
+		request.Options[OptionServerID] = offer.Options[OptionServerID]
+		if lease, e = self.request(ctx, request, broadcastAddress()); e != ErrNak {
+			return
+		}
+	}
+}
+
+// Renew extends lease with unicast REQUEST to server which granted it (RENEWING state).
+func (self *Client) Renew(ctx context.Context, lease *Lease) (*Lease, error) {
+	request := self.newPacket(MessageRequest)
+	request.Broadcast = false
+	request.CIAddr = lease.IP
+	return self.request(ctx, request, &net.UDPAddr{IP: lease.Server, Port: serverPort})
+}
+
+// Rebind extends lease with broadcast REQUEST to any server (REBINDING state).
+func (self *Client) Rebind(ctx context.Context, lease *Lease) (*Lease, error) {
+	request := self.newPacket(MessageRequest)
+	request.Broadcast = false
+	request.CIAddr = lease.IP
+	return self.request(ctx, request, broadcastAddress())
+}
+
+// Release gives address back to server, no reply is expected.
+func (self *Client) Release(lease *Lease) (e error) {
+	release := self.newPacket(MessageRelease)
+	release.Broadcast = false
+	release.CIAddr = lease.IP
+	release.Options[OptionServerID] = lease.Server.To4()
+	delete(release.Options, OptionParameterRequest)
+	_, e = self.conn.WriteTo(release.Marshal(), &net.UDPAddr{IP: lease.Server, Port: serverPort})
+	return
+}
+
+func (self *Client) request(ctx context.Context, request *Packet, destination net.Addr) (lease *Lease, e error) {
+	var reply *Packet
+	if reply, e = self.exchange(ctx, request, destination, MessageAck, MessageNak); e == nil {
+		if reply.MessageType() == MessageNak {
+			e = ErrNak
+		} else {
+			lease = newLease(reply)
+		}
+	}
+	return
+}
+
+// exchange sends packet with exponential retransmission and waits for reply of expected type.
+func (self *Client) exchange(ctx context.Context, packet *Packet, destination net.Addr, replyTypes ...uint8) (reply *Packet, e error) {
+	buffer := make([]byte, 1500)
+	retransmit := initialRetransmit
+	started := time.Now()
+	for {
+		packet.Secs = uint16(time.Since(started) / time.Second)
+		if _, e = self.conn.WriteTo(packet.Marshal(), destination); e != nil {
+			return
+		}
+		// Randomized by one second as recommended by RFC 2131
+		deadline := time.Now().Add(retransmit + time.Duration(rand.Int63n(int64(2*time.Second))) - time.Second)
+		for time.Now().Before(deadline) {
+			if e = ctx.Err(); e != nil {
+				return
+			}
+			readDeadline := time.Now().Add(readSlice)
+			if readDeadline.After(deadline) {
+				readDeadline = deadline
+			}
+			self.conn.SetReadDeadline(readDeadline)
+			n, _, err := self.conn.ReadFrom(buffer)
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					continue
+				}
+				return nil, err
+			}
+			if reply, err = Unmarshal(buffer[:n]); err == nil && self.accept(packet, reply, replyTypes) {
+				return
+			}
+			reply = nil
+		}
+		if retransmit < maxRetransmit {
+			retransmit *= 2
+		}
+	}
+}
+
+func (self *Client) accept(request *Packet, reply *Packet, replyTypes []uint8) bool {
+	if reply.Op != opReply || reply.XID != request.XID || reply.CHAddr.String() != self.Interface.HardwareAddr.String() {
+		return false
+	}
+	for _, replyType := range replyTypes {
+		if reply.MessageType() == replyType {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *Client) newPacket(messageType uint8) *Packet {
+	packet := &Packet{Op: opRequest, XID: rand.Uint32(), Broadcast: true, CHAddr: self.Interface.HardwareAddr,
+		Options: map[uint8][]byte{
+			OptionMessageType: {messageType},
+			OptionClientID:    append([]byte{1}, self.Interface.HardwareAddr...),
+			OptionParameterRequest: {OptionSubnetMask, OptionRouter, OptionDNS, OptionDomainName,
+				OptionLeaseTime, OptionServerID, OptionRenewalTime, OptionRebindingTime},
+		}}
+	maxSize := make([]byte, 2)
+	binary.BigEndian.PutUint16(maxSize, 1500)
+	packet.Options[OptionMaxMessageSize] = maxSize
+	if self.HostName != "" && messageType != MessageRelease {
+		packet.Options[OptionHostName] = []byte(self.HostName)
+	}
+	return packet
+}
+
+func newLease(ack *Packet) *Lease {
+	lease := &Lease{IP: ack.YIAddr, Router: ack.IPOption(OptionRouter), DNS: ack.IPListOption(OptionDNS),
+		DomainName: string(ack.Options[OptionDomainName]), Server: ack.IPOption(OptionServerID),
+		LeaseTime: ack.DurationOption(OptionLeaseTime), RenewalTime: ack.DurationOption(OptionRenewalTime),
+		RebindingTime: ack.DurationOption(OptionRebindingTime), Acquired: time.Now()}
+	if mask := ack.IPOption(OptionSubnetMask); mask != nil {
+		lease.Mask = net.IPMask(mask)
+	} else {
+		lease.Mask = lease.IP.DefaultMask()
+	}
+	if lease.Server == nil {
+		lease.Server = ack.SIAddr
+	}
+	if lease.LeaseTime == 0 {
+		lease.LeaseTime = defaultLeaseTime
+	}
+	// Defaults of RFC 2131 4.4.5
+	if lease.RenewalTime == 0 {
+		lease.RenewalTime = lease.LeaseTime / 2
+	}
+	if lease.RebindingTime == 0 {
+		lease.RebindingTime = lease.LeaseTime * 7 / 8
+	}
+	if lease.RenewalTime < minRenewalTime {
+		lease.RenewalTime = minRenewalTime
+	}
+	if lease.RebindingTime < lease.RenewalTime {
+		lease.RebindingTime = lease.RenewalTime
+	}
+	// LeaseTime is kept as granted, renewal and rebinding happen before it expires
+	if lease.RebindingTime >= lease.LeaseTime {
+		lease.RebindingTime = lease.LeaseTime * 7 / 8
+	}
+	if lease.RenewalTime > lease.RebindingTime {
+		lease.RenewalTime = lease.LeaseTime / 2
+	}
+	return lease
+}
+
+func broadcastAddress() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4bcast, Port: serverPort}
+}
@@ -0,0 +1,260 @@
+package dhcp4
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	serverIP   = net.IP{192, 0, 2, 1}
+	offeredIP  = net.IP{192, 0, 2, 10}
+	clientMAC  = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	errTimeout = timeoutError{}
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// fakeServer is packet connection of client, packets written to it are answered by handle.
+type fakeServer struct {
+	sync.Mutex
+	handle       func(request *Packet) []*Packet
+	replies      chan []byte
+	deadline     time.Time
+	requests     []*Packet
+	destinations []net.Addr
+}
+
+func newFakeServer(handle func(request *Packet) []*Packet) *fakeServer {
+	return &fakeServer{handle: handle, replies: make(chan []byte, 16)}
+}
+
+func (self *fakeServer) WriteTo(data []byte, destination net.Addr) (int, error) {
+	request, err := Unmarshal(data)
+	if err != nil {
+		return 0, err
+	}
+	self.Lock()
+	self.requests = append(self.requests, request)
+	self.destinations = append(self.destinations, destination)
+	self.Unlock()
+	for _, reply := range self.handle(request) {
+		self.replies <- reply.Marshal()
+	}
+	return len(data), nil
+}
+
+func (self *fakeServer) ReadFrom(buffer []byte) (int, net.Addr, error) {
+	self.Lock()
+	timer := time.NewTimer(time.Until(self.deadline))
+	self.Unlock()
+	defer timer.Stop()
+	select {
+	case data := <-self.replies:
+		return copy(buffer, data), &net.UDPAddr{IP: serverIP, Port: serverPort}, nil
+	case <-timer.C:
+		return 0, nil, errTimeout
+	}
+}
+
+func (self *fakeServer) SetReadDeadline(deadline time.Time) error {
+	self.Lock()
+	defer self.Unlock()
+	self.deadline = deadline
+	return nil
+}
+
+func (self *fakeServer) SetDeadline(deadline time.Time) error {
+	return self.SetReadDeadline(deadline)
+}
+
+func (self *fakeServer) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (self *fakeServer) LocalAddr() net.Addr {
+	return &net.UDPAddr{Port: clientPort}
+}
+
+func (self *fakeServer) Close() error {
+	return nil
+}
+
+// sent returns packets client sent and their destinations.
+func (self *fakeServer) sent() ([]*Packet, []net.Addr) {
+	self.Lock()
+	defer self.Unlock()
+	return self.requests, self.destinations
+}
+
+func newTestClient(server *fakeServer) *Client {
+	return &Client{Interface: &net.Interface{HardwareAddr: clientMAC}, conn: server}
+}
+
+func seconds(duration time.Duration) []byte {
+	value := make([]byte, 4)
+	binary.BigEndian.PutUint32(value, uint32(duration/time.Second))
+	return value
+}
+
+func reply(request *Packet, messageType uint8) *Packet {
+	return &Packet{Op: opReply, XID: request.XID, CHAddr: request.CHAddr, YIAddr: offeredIP,
+		Options: map[uint8][]byte{OptionMessageType: {messageType}, OptionServerID: serverIP}}
+}
+
+// server answers DISCOVER with OFFER and REQUEST with ACK of lease with leaseTime, nak
+// REQUESTs are refused first.
+func server(leaseTime time.Duration, nak int) func(request *Packet) []*Packet {
+	return func(request *Packet) []*Packet {
+		switch request.MessageType() {
+		case MessageDiscover:
+			return []*Packet{reply(request, MessageOffer)}
+		case MessageRequest:
+			if nak > 0 {
+				nak--
+				return []*Packet{reply(request, MessageNak)}
+			}
+			ack := reply(request, MessageAck)
+			ack.Options[OptionSubnetMask] = []byte{255, 255, 255, 0}
+			ack.Options[OptionRouter] = serverIP
+			ack.Options[OptionDNS] = []byte{192, 0, 2, 53, 198, 51, 100, 53}
+			ack.Options[OptionDomainName] = []byte("example.org")
+			if leaseTime != 0 {
+				ack.Options[OptionLeaseTime] = seconds(leaseTime)
+			}
+			// Reply of other client is ignored
+			other := reply(request, MessageAck)
+			other.XID++
+			return []*Packet{other, ack}
+		}
+		return nil
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	fake := newFakeServer(server(time.Hour, 0))
+	lease, err := newTestClient(fake).Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lease.IP.Equal(offeredIP) || lease.Mask.String() != "ffffff00" || !lease.Router.Equal(serverIP) ||
+		len(lease.DNS) != 2 || lease.DomainName != "example.org" || !lease.Server.Equal(serverIP) {
+		t.Errorf("unexpected lease %+v", lease)
+	}
+	if lease.LeaseTime != time.Hour || lease.RenewalTime != time.Minute*30 || lease.RebindingTime != time.Minute*52+time.Second*30 {
+		t.Errorf("lease times = %v %v %v", lease.LeaseTime, lease.RenewalTime, lease.RebindingTime)
+	}
+	requests, destinations := fake.sent()
+	if len(requests) != 2 || requests[0].MessageType() != MessageDiscover || requests[1].MessageType() != MessageRequest {
+		t.Fatalf("unexpected exchange %+v", requests)
+	}
+	request := requests[1]
+	if request.XID != requests[0].XID || !request.IPOption(OptionRequestedIP).Equal(offeredIP) ||
+		!request.IPOption(OptionServerID).Equal(serverIP) || !request.Broadcast {
+		t.Errorf("unexpected request %+v", request)
+	}
+	if destinations[1].String() != broadcastAddress().String() {
+		t.Errorf("request sent to %v", destinations[1])
+	}
+}
+
+func TestAcquireStartsOverAfterNak(t *testing.T) {
+	fake := newFakeServer(server(time.Hour, 1))
+	if _, err := newTestClient(fake).Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if requests, _ := fake.sent(); len(requests) != 4 || requests[2].MessageType() != MessageDiscover {
+		t.Errorf("got %d requests, want DISCOVER after NAK", len(requests))
+	}
+}
+
+func TestAcquireCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	fake := newFakeServer(func(*Packet) []*Packet { return nil })
+	if _, err := newTestClient(fake).Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+}
+
+func TestRenewAndRebind(t *testing.T) {
+	fake := newFakeServer(server(time.Hour, 0))
+	client := newTestClient(fake)
+	lease := &Lease{IP: offeredIP, Server: serverIP}
+	if _, err := client.Renew(context.Background(), lease); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Rebind(context.Background(), lease); err != nil {
+		t.Fatal(err)
+	}
+	requests, destinations := fake.sent()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	for i, destination := range []string{"192.0.2.1:67", broadcastAddress().String()} {
+		if request := requests[i]; request.Broadcast || !request.CIAddr.Equal(offeredIP) ||
+			request.Options[OptionRequestedIP] != nil {
+			t.Errorf("unexpected request %+v", request)
+		}
+		if destinations[i].String() != destination {
+			t.Errorf("request %d sent to %v, want %s", i, destinations[i], destination)
+		}
+	}
+}
+
+func TestRenewNak(t *testing.T) {
+	client := newTestClient(newFakeServer(server(time.Hour, 1)))
+	if _, err := client.Renew(context.Background(), &Lease{IP: offeredIP, Server: serverIP}); err != ErrNak {
+		t.Errorf("got %v, want ErrNak", err)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	fake := newFakeServer(func(*Packet) []*Packet { return nil })
+	if err := newTestClient(fake).Release(&Lease{IP: offeredIP, Server: serverIP}); err != nil {
+		t.Fatal(err)
+	}
+	requests, destinations := fake.sent()
+	if len(requests) != 1 || requests[0].MessageType() != MessageRelease || !requests[0].IPOption(OptionServerID).Equal(serverIP) ||
+		destinations[0].String() != "192.0.2.1:67" {
+		t.Errorf("unexpected release %+v to %v", requests, destinations)
+	}
+}
+
+func TestLeaseTimes(t *testing.T) {
+	tests := []struct {
+		name                                  string
+		leaseTime, renewalTime, rebindingTime time.Duration
+		wantLease, wantRenewal, wantRebinding time.Duration
+	}{
+		{"defaults", time.Hour, 0, 0, time.Hour, time.Minute * 30, time.Minute*52 + time.Second*30},
+		{"server times", time.Hour, time.Minute * 10, time.Minute * 20, time.Hour, time.Minute * 10, time.Minute * 20},
+		{"no lease time", 0, 0, 0, defaultLeaseTime, defaultLeaseTime / 2, defaultLeaseTime * 7 / 8},
+		{"tiny lease", time.Second, 0, 0, time.Second, time.Second / 2, time.Second * 7 / 8},
+		{"short lease", time.Second * 90, 0, 0, time.Second * 90, minRenewalTime, time.Second * 90 * 7 / 8},
+		{"tiny renewal", time.Hour, time.Second, time.Second * 2, time.Hour, minRenewalTime, minRenewalTime},
+		{"rebinding after expiry", time.Hour, 0, time.Hour * 2, time.Hour, time.Minute * 30, time.Minute*52 + time.Second*30},
+	}
+	for _, test := range tests {
+		ack := &Packet{YIAddr: offeredIP, Options: map[uint8][]byte{}}
+		for code, value := range map[uint8]time.Duration{OptionLeaseTime: test.leaseTime,
+			OptionRenewalTime: test.renewalTime, OptionRebindingTime: test.rebindingTime} {
+			if value != 0 {
+				ack.Options[code] = seconds(value)
+			}
+		}
+		lease := newLease(ack)
+		if lease.LeaseTime != test.wantLease || lease.RenewalTime != test.wantRenewal || lease.RebindingTime != test.wantRebinding {
+			t.Errorf("%s: got %v %v %v, want %v %v %v", test.name, lease.LeaseTime, lease.RenewalTime, lease.RebindingTime,
+				test.wantLease, test.wantRenewal, test.wantRebinding)
+		}
+	}
+}
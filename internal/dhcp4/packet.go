@@ -0,0 +1,165 @@
+package dhcp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	opRequest = 1
+	opReply   = 2
+
+	MessageDiscover = 1
+	MessageOffer    = 2
+	MessageRequest  = 3
+	MessageDecline  = 4
+	MessageAck      = 5
+	MessageNak      = 6
+	MessageRelease  = 7
+
+	OptionSubnetMask       = 1
+	OptionRouter           = 3
+	OptionDNS              = 6
+	OptionHostName         = 12
+	OptionDomainName       = 15
+	OptionRequestedIP      = 50
+	OptionLeaseTime        = 51
+	OptionMessageType      = 53
+	OptionServerID         = 54
+	OptionParameterRequest = 55
+	OptionMaxMessageSize   = 57
+	OptionRenewalTime      = 58
+	OptionRebindingTime    = 59
+	OptionClientID         = 61
+	optionPad              = 0
+	optionEnd              = 255
+
+	flagBroadcast = 0x8000
+	headerSize    = 236
+	minPacketSize = 300
+)
+
+var magicCookie = []byte{99, 130, 83, 99}
+
+// Packet is BOOTP message with DHCP options (RFC 2131, RFC 2132).
+type Packet struct {
+	Op        uint8
+	XID       uint32
+	Secs      uint16
+	Broadcast bool
+	CIAddr    net.IP
+	YIAddr    net.IP
+	SIAddr    net.IP
+	GIAddr    net.IP
+	CHAddr    net.HardwareAddr
+	Options   map[uint8][]byte
+}
+
+func (self *Packet) MessageType() uint8 {
+	if value := self.Options[OptionMessageType]; len(value) == 1 {
+		return value[0]
+	}
+	return 0
+}
+
+func (self *Packet) IPOption(code uint8) net.IP {
+	if value := self.Options[code]; len(value) >= 4 {
+		return net.IP(value[:4])
+	}
+	return nil
+}
+
+func (self *Packet) IPListOption(code uint8) (ips []net.IP) {
+	value := self.Options[code]
+	for i := 0; i+4 <= len(value); i += 4 {
+		ips = append(ips, net.IP(value[i:i+4]))
+	}
+	return
+}
+
+func (self *Packet) DurationOption(code uint8) time.Duration {
+	if value := self.Options[code]; len(value) == 4 {
+		return time.Duration(binary.BigEndian.Uint32(value)) * time.Second
+	}
+	return 0
+}
+
+func (self *Packet) Marshal() []byte {
+	data := make([]byte, headerSize, minPacketSize)
+	data[0] = self.Op
+	data[1] = 1 // Ethernet
+	data[2] = 6
+	binary.BigEndian.PutUint32(data[4:8], self.XID)
+	binary.BigEndian.PutUint16(data[8:10], self.Secs)
+	if self.Broadcast {
+		binary.BigEndian.PutUint16(data[10:12], flagBroadcast)
+	}
+	copy(data[12:16], self.CIAddr.To4())
+	copy(data[16:20], self.YIAddr.To4())
+	copy(data[20:24], self.SIAddr.To4())
+	copy(data[24:28], self.GIAddr.To4())
+	copy(data[28:44], self.CHAddr)
+	data = append(data, magicCookie...)
+	// Message type goes first, some servers expect it
+	if value, ok := self.Options[OptionMessageType]; ok {
+		data = append(data, OptionMessageType, uint8(len(value)))
+		data = append(data, value...)
+	}
+	for code, value := range self.Options {
+		if code != OptionMessageType {
+			data = append(data, code, uint8(len(value)))
+			data = append(data, value...)
+		}
+	}
+	data = append(data, optionEnd)
+	for len(data) < minPacketSize {
+		data = append(data, optionPad)
+	}
+	return data
+}
+
+func Unmarshal(data []byte) (packet *Packet, e error) {
+	if len(data) < headerSize+len(magicCookie) {
+		return nil, errors.New("dhcp packet is too short")
+	}
+	if string(data[headerSize:headerSize+4]) != string(magicCookie) {
+		return nil, errors.New("dhcp magic cookie mismatch")
+	}
+	hlen := int(data[2])
+	if hlen > 16 {
+		hlen = 16
+	}
+	packet = &Packet{
+		Op:        data[0],
+		XID:       binary.BigEndian.Uint32(data[4:8]),
+		Secs:      binary.BigEndian.Uint16(data[8:10]),
+		Broadcast: binary.BigEndian.Uint16(data[10:12])&flagBroadcast != 0,
+		CIAddr:    net.IP(append([]byte{}, data[12:16]...)),
+		YIAddr:    net.IP(append([]byte{}, data[16:20]...)),
+		SIAddr:    net.IP(append([]byte{}, data[20:24]...)),
+		GIAddr:    net.IP(append([]byte{}, data[24:28]...)),
+		CHAddr:    net.HardwareAddr(append([]byte{}, data[28:28+hlen]...)),
+		Options:   make(map[uint8][]byte),
+	}
+	options := data[headerSize+4:]
+	for i := 0; i < len(options); {
+		code := options[i]
+		if code == optionEnd {
+			break
+		}
+		if code == optionPad {
+			i++
+			continue
+		}
+		if i+1 >= len(options) || i+2+int(options[i+1]) > len(options) {
+			return nil, errors.New("dhcp option is truncated")
+		}
+		length := int(options[i+1])
+		// Concatenate split options (RFC 3396)
+		packet.Options[code] = append(packet.Options[code], options[i+2:i+2+length]...)
+		i += 2 + length
+	}
+	return
+}
@@ -0,0 +1,100 @@
+package dhcp4
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPacketMarshalUnmarshal(t *testing.T) {
+	packet := &Packet{Op: opReply, XID: 0x12345678, Secs: 3, Broadcast: true,
+		CIAddr: net.IP{0, 0, 0, 0}, YIAddr: net.IP{192, 0, 2, 10}, SIAddr: net.IP{192, 0, 2, 1}, GIAddr: net.IP{0, 0, 0, 0},
+		CHAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01},
+		Options: map[uint8][]byte{
+			OptionMessageType: {MessageAck},
+			OptionSubnetMask:  {255, 255, 255, 0},
+			OptionRouter:      {192, 0, 2, 1},
+			OptionDNS:         {192, 0, 2, 53, 198, 51, 100, 53},
+			OptionDomainName:  []byte("example.org"),
+			OptionLeaseTime:   {0, 0, 0x0e, 0x10},
+		}}
+	data := packet.Marshal()
+	if len(data) < minPacketSize {
+		t.Errorf("packet size = %d, want at least %d", len(data), minPacketSize)
+	}
+	if data[headerSize+4] != OptionMessageType {
+		t.Errorf("first option = %d, want message type", data[headerSize+4])
+	}
+	unmarshaled, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(unmarshaled, packet) {
+		t.Errorf("got %+v, want %+v", unmarshaled, packet)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	valid := (&Packet{Op: opReply, Options: map[uint8][]byte{OptionMessageType: {MessageOffer}}}).Marshal()
+	badCookie := append([]byte(nil), valid...)
+	badCookie[headerSize] = 0
+	truncated := append(append([]byte(nil), valid[:headerSize+4]...), OptionRouter, 4, 192, 0)
+	noLength := append(append([]byte(nil), valid[:headerSize+4]...), OptionRouter)
+	for name, data := range map[string][]byte{
+		"empty":            nil,
+		"header only":      valid[:headerSize],
+		"magic cookie":     badCookie,
+		"truncated option": truncated,
+		"option no length": noLength,
+	} {
+		if packet, err := Unmarshal(data); err == nil {
+			t.Errorf("%s: got %+v, want error", name, packet)
+		}
+	}
+}
+
+func TestUnmarshalOptions(t *testing.T) {
+	data := (&Packet{Op: opReply, Options: map[uint8][]byte{}}).Marshal()[:headerSize+4]
+	data = append(data,
+		optionPad, optionPad,
+		OptionMessageType, 1, MessageAck,
+		// Domain name split into two options (RFC 3396)
+		OptionDomainName, 4, 'e', 'x', 'a', 'm',
+		OptionDomainName, 7, 'p', 'l', 'e', '.', 'o', 'r', 'g',
+		OptionDNS, 8, 192, 0, 2, 53, 198, 51, 100, 53,
+		OptionRouter, 4, 192, 0, 2, 1,
+		OptionLeaseTime, 4, 0, 0, 0x0e, 0x10,
+		OptionRenewalTime, 2, 0, 1,
+		optionEnd,
+		OptionHostName, 4, 'h', 'o', 's', 't')
+	packet, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.MessageType() != MessageAck {
+		t.Errorf("MessageType = %d, want %d", packet.MessageType(), MessageAck)
+	}
+	if domain := string(packet.Options[OptionDomainName]); domain != "example.org" {
+		t.Errorf("domain = %q, want example.org", domain)
+	}
+	if dns := packet.IPListOption(OptionDNS); len(dns) != 2 || !dns[0].Equal(net.IPv4(192, 0, 2, 53)) ||
+		!dns[1].Equal(net.IPv4(198, 51, 100, 53)) {
+		t.Errorf("DNS = %v", dns)
+	}
+	if router := packet.IPOption(OptionRouter); !router.Equal(net.IPv4(192, 0, 2, 1)) {
+		t.Errorf("router = %v", router)
+	}
+	if mask := packet.IPOption(OptionSubnetMask); mask != nil {
+		t.Errorf("missing mask = %v", mask)
+	}
+	if leaseTime := packet.DurationOption(OptionLeaseTime); leaseTime != time.Hour {
+		t.Errorf("lease time = %v, want 1h", leaseTime)
+	}
+	if renewalTime := packet.DurationOption(OptionRenewalTime); renewalTime != 0 {
+		t.Errorf("malformed renewal time = %v, want 0", renewalTime)
+	}
+	if _, ok := packet.Options[OptionHostName]; ok {
+		t.Error("option after end is parsed")
+	}
+}
@@ -0,0 +1,312 @@
+package netlink
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	ifaFlags = 8
+
+	// rtnetlink multicast groups, RTMGRP_* of linux/rtnetlink.h
+	GroupIPv4Address = 0x10
+	GroupIPv4Route   = 0x40
+	GroupIPv6Address = 0x100
+	GroupIPv6Route   = 0x400
+)
+
+type Address struct {
+	Index     int
+	IP        net.IP
+	PrefixLen int
+	Scope     uint8
+	Flags     uint32
+}
+
+type Route struct {
+	Index   int
+	Family  int
+	Table   uint8
+	Dst     *net.IPNet
+	Gateway net.IP
+}
+
+// Message is address or route notification, Deleted is set for RTM_DELADDR and RTM_DELROUTE.
+type Message struct {
+	Address *Address
+	Route   *Route
+	Deleted bool
+}
+
+type Conn struct {
+	file *os.File
+}
+
+// Dial opens rtnetlink socket subscribed to multicast groups.
+func Dial(groups uint32) (conn *Conn, e error) {
+	if fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.NETLINK_ROUTE); err == nil {
+		if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups}); err == nil {
+			// Non-blocking descriptor is served by runtime poller, Close unblocks Receive
+			conn = &Conn{file: os.NewFile(uintptr(fd), "netlink")}
+		} else {
+			syscall.Close(fd)
+			e = err
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+func (self *Conn) Close() error {
+	return self.file.Close()
+}
+
+// Receive blocks until notifications arrive or connection is closed.
+func (self *Conn) Receive() (messages []Message, e error) {
+	buffer := make([]byte, os.Getpagesize()*4)
+	if n, err := self.file.Read(buffer); err == nil {
+		if netlinkMessages, err := syscall.ParseNetlinkMessage(buffer[:n]); err == nil {
+			for _, netlinkMessage := range netlinkMessages {
+				if message, ok := parseMessage(&netlinkMessage); ok {
+					messages = append(messages, message)
+				}
+			}
+		} else {
+			e = err
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+// IsOverrun reports whether notifications were lost because receive buffer overflowed, state
+// has to be dumped again then.
+func IsOverrun(err error) bool {
+	return errors.Is(err, syscall.ENOBUFS)
+}
+
+// ListAddresses returns addresses of interface, all interfaces when index is 0.
+func ListAddresses(index int) (addresses []Address, e error) {
+	e = dump(syscall.RTM_GETADDR, func(message Message) {
+		if message.Address != nil && (index == 0 || message.Address.Index == index) {
+			addresses = append(addresses, *message.Address)
+		}
+	})
+	return
+}
+
+// ListRoutes returns routes of main table going through interface, all interfaces when index is 0.
+func ListRoutes(index int) (routes []Route, e error) {
+	e = dump(syscall.RTM_GETROUTE, func(message Message) {
+		if message.Route != nil && message.Route.Table == syscall.RT_TABLE_MAIN &&
+			(index == 0 || message.Route.Index == index) {
+			routes = append(routes, *message.Route)
+		}
+	})
+	return
+}
+
+func dump(request int, callBack func(Message)) (e error) {
+	if rib, err := syscall.NetlinkRIB(request, syscall.AF_UNSPEC); err == nil {
+		if netlinkMessages, err := syscall.ParseNetlinkMessage(rib); err == nil {
+			for _, netlinkMessage := range netlinkMessages {
+				if message, ok := parseMessage(&netlinkMessage); ok {
+					callBack(message)
+				}
+			}
+		} else {
+			e = err
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+func parseMessage(netlinkMessage *syscall.NetlinkMessage) (message Message, ok bool) {
+	switch netlinkMessage.Header.Type {
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		if len(netlinkMessage.Data) < syscall.SizeofIfAddrmsg {
+			return
+		}
+		if attributes, err := syscall.ParseNetlinkRouteAttr(netlinkMessage); err == nil {
+			message.Address = parseAddress(netlinkMessage.Data, attributes)
+			message.Deleted = netlinkMessage.Header.Type == syscall.RTM_DELADDR
+			ok = message.Address.IP != nil
+		}
+	case syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE:
+		if len(netlinkMessage.Data) < syscall.SizeofRtMsg {
+			return
+		}
+		if attributes, err := syscall.ParseNetlinkRouteAttr(netlinkMessage); err == nil {
+			message.Route = parseRoute(netlinkMessage.Data, attributes)
+			message.Deleted = netlinkMessage.Header.Type == syscall.RTM_DELROUTE
+			ok = true
+		}
+	}
+	return
+}
+
+func parseAddress(data []byte, attributes []syscall.NetlinkRouteAttr) *Address {
+	header := (*syscall.IfAddrmsg)(unsafe.Pointer(&data[0]))
+	address := &Address{Index: int(header.Index), PrefixLen: int(header.Prefixlen), Scope: header.Scope,
+		Flags: uint32(header.Flags)}
+	for _, attribute := range attributes {
+		switch attribute.Attr.Type {
+		case syscall.IFA_ADDRESS:
+			// IFA_LOCAL takes precedence, IFA_ADDRESS is peer address on point-to-point links
+			if address.IP == nil {
+				address.IP = net.IP(attribute.Value)
+			}
+		case syscall.IFA_LOCAL:
+			address.IP = net.IP(attribute.Value)
+		case ifaFlags:
+			if len(attribute.Value) >= 4 {
+				address.Flags = nativeEndian.Uint32(attribute.Value)
+			}
+		}
+	}
+	return address
+}
+
+func parseRoute(data []byte, attributes []syscall.NetlinkRouteAttr) *Route {
+	header := (*syscall.RtMsg)(unsafe.Pointer(&data[0]))
+	route := &Route{Family: int(header.Family), Table: header.Table}
+	for _, attribute := range attributes {
+		switch attribute.Attr.Type {
+		case syscall.RTA_DST:
+			route.Dst = &net.IPNet{IP: net.IP(attribute.Value),
+				Mask: net.CIDRMask(int(header.Dst_len), len(attribute.Value)*8)}
+		case syscall.RTA_GATEWAY:
+			route.Gateway = net.IP(attribute.Value)
+		case syscall.RTA_OIF:
+			if len(attribute.Value) >= 4 {
+				route.Index = int(nativeEndian.Uint32(attribute.Value))
+			}
+		}
+	}
+	return route
+}
+
+// IsDefault reports whether route has no destination, i.e. 0.0.0.0/0 or ::/0.
+func (self *Route) IsDefault() bool {
+	return self.Dst == nil
+}
+
+var nativeEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	value := uint16(1)
+	if (*[2]byte)(unsafe.Pointer(&value))[0] == 0 {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+// AddAddress assigns address to interface, existing address is replaced.
+func AddAddress(index int, address *net.IPNet) error {
+	return request(syscall.RTM_NEWADDR, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, addressMessage(index, address))
+}
+
+func DeleteAddress(index int, address *net.IPNet) error {
+	return request(syscall.RTM_DELADDR, 0, addressMessage(index, address))
+}
+
+// AddDefaultRoute adds default route of gateway family through interface. Default routes
+// through other interfaces are kept, existing identical route is not an error.
+func AddDefaultRoute(index int, gateway net.IP) (e error) {
+	if e = request(syscall.RTM_NEWROUTE, syscall.NLM_F_CREATE, defaultRouteMessage(index, gateway)); e == syscall.EEXIST {
+		e = nil
+	}
+	return
+}
+
+func DeleteDefaultRoute(index int, gateway net.IP) error {
+	return request(syscall.RTM_DELROUTE, 0, defaultRouteMessage(index, gateway))
+}
+
+func addressMessage(index int, address *net.IPNet) []byte {
+	family, ip := family(address.IP)
+	prefixLen, _ := address.Mask.Size()
+	header := syscall.IfAddrmsg{Family: family, Prefixlen: uint8(prefixLen), Scope: syscall.RT_SCOPE_UNIVERSE,
+		Index: uint32(index)}
+	data := (*[syscall.SizeofIfAddrmsg]byte)(unsafe.Pointer(&header))[:]
+	data = appendAttribute(data, syscall.IFA_LOCAL, ip)
+	data = appendAttribute(data, syscall.IFA_ADDRESS, ip)
+	return data
+}
+
+func defaultRouteMessage(index int, gateway net.IP) []byte {
+	family, ip := family(gateway)
+	header := syscall.RtMsg{Family: family, Table: syscall.RT_TABLE_MAIN, Protocol: syscall.RTPROT_STATIC,
+		Scope: syscall.RT_SCOPE_UNIVERSE, Type: syscall.RTN_UNICAST}
+	data := (*[syscall.SizeofRtMsg]byte)(unsafe.Pointer(&header))[:]
+	data = appendAttribute(data, syscall.RTA_GATEWAY, ip)
+	oif := make([]byte, 4)
+	nativeEndian.PutUint32(oif, uint32(index))
+	data = appendAttribute(data, syscall.RTA_OIF, oif)
+	return data
+}
+
+func family(ip net.IP) (uint8, net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return syscall.AF_INET, ip4
+	}
+	return syscall.AF_INET6, ip.To16()
+}
+
+func appendAttribute(data []byte, attributeType uint16, value []byte) []byte {
+	attribute := make([]byte, rtaAlign(syscall.SizeofRtAttr+len(value)))
+	nativeEndian.PutUint16(attribute[0:2], uint16(syscall.SizeofRtAttr+len(value)))
+	nativeEndian.PutUint16(attribute[2:4], attributeType)
+	copy(attribute[syscall.SizeofRtAttr:], value)
+	return append(append([]byte{}, data...), attribute...)
+}
+
+func rtaAlign(length int) int {
+	return (length + syscall.RTA_ALIGNTO - 1) & ^(syscall.RTA_ALIGNTO - 1)
+}
+
+// request sends rtnetlink request and waits for kernel acknowledgement.
+func request(messageType uint16, flags uint16, data []byte) (e error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	if e = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); e != nil {
+		return
+	}
+	header := syscall.NlMsghdr{Len: uint32(syscall.SizeofNlMsghdr + len(data)), Type: messageType,
+		Flags: syscall.NLM_F_REQUEST | syscall.NLM_F_ACK | flags, Seq: 1}
+	message := append((*[syscall.SizeofNlMsghdr]byte)(unsafe.Pointer(&header))[:], data...)
+	if e = syscall.Sendto(fd, message, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); e != nil {
+		return
+	}
+	buffer := make([]byte, os.Getpagesize())
+	for {
+		n, _, err := syscall.Recvfrom(fd, buffer, 0)
+		if err != nil {
+			return err
+		}
+		netlinkMessages, err := syscall.ParseNetlinkMessage(buffer[:n])
+		if err != nil {
+			return err
+		}
+		for _, netlinkMessage := range netlinkMessages {
+			if netlinkMessage.Header.Seq == header.Seq && netlinkMessage.Header.Type == syscall.NLMSG_ERROR {
+				if len(netlinkMessage.Data) >= 4 {
+					if errno := int32(nativeEndian.Uint32(netlinkMessage.Data[0:4])); errno != 0 {
+						e = syscall.Errno(-errno)
+					}
+				}
+				return
+			}
+		}
+	}
+}
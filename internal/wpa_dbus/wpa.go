@@ -1,29 +1,37 @@
 package wpa_dbus
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/godbus/dbus"
 	"github.com/mark2b/wpa-connect/internal/log"
 )
 
 type WPA struct {
+	Context       context.Context
 	Connection    *dbus.Conn
 	Object        dbus.BusObject
 	Interfaces    []InterfaceWPA
 	Interface     *InterfaceWPA
+	EapMethods    []string
 	SignalChannel chan *dbus.Signal
 	Error         error
 }
 
 func NewWPA() (wpa *WPA, e error) {
+	return NewWPAWithContext(context.Background())
+}
+
+// NewWPAWithContext creates WPA which D-Bus calls are abandoned once ctx is done.
+func NewWPAWithContext(ctx context.Context) (wpa *WPA, e error) {
 	if conn, err := dbus.SystemBus(); err == nil {
 		if obj := conn.Object("fi.w1.wpa_supplicant1", "/fi/w1/wpa_supplicant1"); obj != nil {
-			wpa = &WPA{Connection: conn, Object: obj}
+			wpa = &WPA{Context: ctx, Connection: conn, Object: obj}
 		} else {
-			conn.Close()
-			err = errors.New("Can't create WPA object")
+			e = errors.New("Can't create WPA object")
 		}
 	} else {
 		e = err
@@ -32,9 +40,29 @@ func NewWPA() (wpa *WPA, e error) {
 	return
 }
 
+// Detached returns WPA sharing connection which calls are not bound to context,
+// it is used for cleanup after cancellation.
+func (self *WPA) Detached() *WPA {
+	return &WPA{Context: context.Background(), Connection: self.Connection, Object: self.Object}
+}
+
 func (self *WPA) ReadInterface(ifname string) *WPA {
 	if self.Error == nil {
-		if call := self.Object.Call("fi.w1.wpa_supplicant1.GetInterface", 0, ifname); call.Err == nil {
+		if call := self.call(self.Object, "fi.w1.wpa_supplicant1.GetInterface", ifname); call.Err == nil {
+			var objectPath = dbus.ObjectPath(call.Body[0].(dbus.ObjectPath))
+			self.Interface = &InterfaceWPA{WPA: self, Object: self.Connection.Object("fi.w1.wpa_supplicant1", objectPath)}
+		} else {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+// CreateInterface makes supplicant manage interface described by args (Ifname, Driver, ConfigFile,
+// BridgeIfname), Interface is set to created interface.
+func (self *WPA) CreateInterface(args map[string]dbus.Variant) *WPA {
+	if self.Error == nil {
+		if call := self.call(self.Object, "fi.w1.wpa_supplicant1.CreateInterface", args); call.Err == nil {
 			var objectPath = dbus.ObjectPath(call.Body[0].(dbus.ObjectPath))
 			self.Interface = &InterfaceWPA{WPA: self, Object: self.Connection.Object("fi.w1.wpa_supplicant1", objectPath)}
 		} else {
@@ -44,6 +72,15 @@ func (self *WPA) ReadInterface(ifname string) *WPA {
 	return self
 }
 
+func (self *WPA) RemoveInterface(path dbus.ObjectPath) *WPA {
+	if self.Error == nil {
+		if call := self.call(self.Object, "fi.w1.wpa_supplicant1.RemoveInterface", path); call.Err != nil {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
 func (self *WPA) ReadInterfaceList() *WPA {
 	if self.Error == nil {
 		if interfaces, err := self.get("fi.w1.wpa_supplicant1.Interfaces", self.Object); err == nil {
@@ -60,37 +97,103 @@ func (self *WPA) ReadInterfaceList() *WPA {
 	return self
 }
 
+func (self *WPA) ReadEapMethods() *WPA {
+	if self.Error == nil {
+		if value, err := self.get("fi.w1.wpa_supplicant1.EapMethods", self.Object); err == nil {
+			self.EapMethods = value.([]string)
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
+
 func (self *WPA) get(name string, target dbus.BusObject) (value interface{}, e error) {
-	if variant, err := target.GetProperty(name); err == nil {
-		value = variant.Value()
+	i := strings.LastIndex(name, ".")
+	var variant dbus.Variant
+	if call := self.call(target, "org.freedesktop.DBus.Properties.Get", name[:i], name[i+1:]); call.Err == nil {
+		if err := call.Store(&variant); err == nil {
+			value = variant.Value()
+		} else {
+			e = err
+		}
 	} else {
-		e = err
+		e = call.Err
 	}
 	return
 }
 
+// getAll reads all properties of D-Bus interface in single call.
+func (self *WPA) getAll(interfaceName string, target dbus.BusObject) (properties map[string]dbus.Variant, e error) {
+	if call := self.call(target, "org.freedesktop.DBus.Properties.GetAll", interfaceName); call.Err == nil {
+		e = call.Store(&properties)
+	} else {
+		e = call.Err
+	}
+	return
+}
+
+func (self *WPA) set(name string, target dbus.BusObject, value interface{}) (e error) {
+	i := strings.LastIndex(name, ".")
+	if call := self.call(target, "org.freedesktop.DBus.Properties.Set", name[:i], name[i+1:], dbus.MakeVariant(value)); call.Err != nil {
+		e = call.Err
+	}
+	return
+}
+
+// call invokes method and waits for reply until WPA context is done. Reply channel is buffered,
+// so late reply of abandoned call does not block connection. Method is not invoked at all when
+// context is done already, abandoned one may still be applied by supplicant.
+func (self *WPA) call(target dbus.BusObject, method string, args ...interface{}) *dbus.Call {
+	if err := self.Context.Err(); err != nil {
+		return &dbus.Call{Method: method, Args: args, Err: err}
+	}
+	ch := make(chan *dbus.Call, 1)
+	if call := target.Go(method, 0, ch, args...); call.Err != nil {
+		return call
+	}
+	select {
+	case call := <-ch:
+		return call
+	case <-self.Context.Done():
+		return &dbus.Call{Method: method, Args: args, Err: self.Context.Err()}
+	}
+}
+
+// removeMatch is a cleanup call and is not bound to WPA context, match rules must be removed
+// after cancellation too.
+func (self *WPA) removeMatch(match string) error {
+	return self.Connection.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, match).Err
+}
+
+// WaitForSignals delivers bus signals to callBack until StopWaitForSignals. callBack must not block,
+// connection stops delivering signals to all subscribers while it waits.
 func (self *WPA) WaitForSignals(callBack func(*WPA, *dbus.Signal)) *WPA {
 	log.Log.Debug("WaitForSignals")
 	self.SignalChannel = make(chan *dbus.Signal, 10)
 	self.Connection.Signal(self.SignalChannel)
-	go func() {
-		for ch := range self.SignalChannel {
+	go func(signalChannel chan *dbus.Signal) {
+		for ch := range signalChannel {
 			callBack(self, ch)
 		}
-	}()
+	}(self.SignalChannel)
 	return self
 }
 
 func (self *WPA) StopWaitForSignals() *WPA {
 	log.Log.Debug("StopWaitForSignals")
-	self.Connection.RemoveSignal(self.SignalChannel)
+	if self.SignalChannel != nil {
+		self.Connection.RemoveSignal(self.SignalChannel)
+		close(self.SignalChannel)
+		self.SignalChannel = nil
+	}
 	return self
 }
 
 func (self *WPA) AddSignalsObserver() *WPA {
 	log.Log.Debug("AddSignalsObserver.WPA")
 	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1',path='%s'", self.Object.Path())
-	if call := self.Connection.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, match); call.Err == nil {
+	if call := self.call(self.Connection.BusObject(), "org.freedesktop.DBus.AddMatch", match); call.Err == nil {
 	} else {
 		self.Error = call.Err
 	}
@@ -100,9 +203,8 @@ func (self *WPA) AddSignalsObserver() *WPA {
 func (self *WPA) RemoveSignalsObserver() *WPA {
 	log.Log.Debug("RemoveSignalsObserver.WPA")
 	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1',path='%s'", self.Object.Path())
-	if call := self.Connection.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, match); call.Err == nil {
-	} else {
-		self.Error = call.Err
+	if err := self.removeMatch(match); err != nil && self.Error == nil {
+		self.Error = err
 	}
 	return self
 }
@@ -14,26 +14,60 @@ type BSSWPA struct {
 	BSSID         string
 	SSID          string
 	WPAKeyMgmt    []string
+	WPAPairwise   []string
+	WPAGroup      string
 	RSNKeyMgmt    []string
+	RSNPairwise   []string
+	RSNGroup      string
+	RSNMgmtGroup  string
 	WPS           string
 	Frequency     uint16
 	Signal        int16
 	Age           uint32
 	Mode          string
 	Privacy       bool
+	IEs           []byte
 	SignalChannel chan *dbus.Signal
 	Error         error
 }
 
+// ReadProperties reads all BSS properties in single GetAll call.
+func (self *BSSWPA) ReadProperties() *BSSWPA {
+	if self.Error == nil {
+		if properties, err := self.Interface.WPA.getAll("fi.w1.wpa_supplicant1.BSS", self.Object); err == nil {
+			if value, ok := properties["BSSID"].Value().([]byte); ok {
+				self.BSSID = hex.EncodeToString(value)
+			}
+			if value, ok := properties["SSID"].Value().([]byte); ok {
+				self.SSID = string(value)
+			}
+			if value, ok := properties["WPA"].Value().(map[string]dbus.Variant); ok {
+				self.decodeWPA(value)
+			}
+			if value, ok := properties["RSN"].Value().(map[string]dbus.Variant); ok {
+				self.decodeRSN(value)
+			}
+			if value, ok := properties["WPS"].Value().(map[string]dbus.Variant); ok {
+				self.WPS, _ = value["Type"].Value().(string)
+			}
+			self.Frequency, _ = properties["Frequency"].Value().(uint16)
+			self.Signal, _ = properties["Signal"].Value().(int16)
+			self.Age, _ = properties["Age"].Value().(uint32)
+			self.Mode, _ = properties["Mode"].Value().(string)
+			self.Privacy, _ = properties["Privacy"].Value().(bool)
+			self.IEs, _ = properties["IEs"].Value().([]byte)
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
+
 func (self *BSSWPA) ReadWPA() *BSSWPA {
 	if self.Error == nil {
 		if value, err := self.Interface.WPA.get("fi.w1.wpa_supplicant1.BSS.WPA", self.Object); err == nil {
 			if value, ok := value.(map[string]dbus.Variant); ok {
-				for key, variant := range value {
-					if key == "KeyMgmt" {
-						self.WPAKeyMgmt = variant.Value().([]string)
-					}
-				}
+				self.decodeWPA(value)
 			}
 		} else {
 			self.Error = err
@@ -46,11 +80,7 @@ func (self *BSSWPA) ReadRSN() *BSSWPA {
 	if self.Error == nil {
 		if value, err := self.Interface.WPA.get("fi.w1.wpa_supplicant1.BSS.RSN", self.Object); err == nil {
 			if value, ok := value.(map[string]dbus.Variant); ok {
-				for key, variant := range value {
-					if key == "KeyMgmt" {
-						self.RSNKeyMgmt = variant.Value().([]string)
-					}
-				}
+				self.decodeRSN(value)
 			}
 		} else {
 			self.Error = err
@@ -59,6 +89,21 @@ func (self *BSSWPA) ReadRSN() *BSSWPA {
 	return self
 }
 
+// decodeWPA reads WPA dictionary, KeyMgmt, Pairwise and Group.
+func (self *BSSWPA) decodeWPA(value map[string]dbus.Variant) {
+	self.WPAKeyMgmt, _ = value["KeyMgmt"].Value().([]string)
+	self.WPAPairwise, _ = value["Pairwise"].Value().([]string)
+	self.WPAGroup, _ = value["Group"].Value().(string)
+}
+
+// decodeRSN reads RSN dictionary, KeyMgmt, Pairwise, Group and MgmtGroup.
+func (self *BSSWPA) decodeRSN(value map[string]dbus.Variant) {
+	self.RSNKeyMgmt, _ = value["KeyMgmt"].Value().([]string)
+	self.RSNPairwise, _ = value["Pairwise"].Value().([]string)
+	self.RSNGroup, _ = value["Group"].Value().(string)
+	self.RSNMgmtGroup, _ = value["MgmtGroup"].Value().(string)
+}
+
 func (self *BSSWPA) ReadWPS() *BSSWPA {
 	if self.Error == nil {
 		if value, err := self.Interface.WPA.get("fi.w1.wpa_supplicant1.BSS.WPS", self.Object); err == nil {
@@ -153,10 +198,21 @@ func (self *BSSWPA) ReadPrivacy() *BSSWPA {
 	return self
 }
 
+func (self *BSSWPA) ReadIEs() *BSSWPA {
+	if self.Error == nil {
+		if value, err := self.Interface.WPA.get("fi.w1.wpa_supplicant1.BSS.IEs", self.Object); err == nil {
+			self.IEs = value.([]byte)
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
+
 func (self *BSSWPA) AddSignalsObserver() *BSSWPA {
 	log.Log.Debug("AddSignalsObserver.BSS")
 	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1.BSS',path='%s'", self.Object.Path())
-	if call := self.Interface.WPA.Connection.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, match); call.Err == nil {
+	if call := self.Interface.WPA.call(self.Interface.WPA.Connection.BusObject(), "org.freedesktop.DBus.AddMatch", match); call.Err == nil {
 	} else {
 		self.Error = call.Err
 	}
@@ -166,9 +222,8 @@ func (self *BSSWPA) AddSignalsObserver() *BSSWPA {
 func (self *BSSWPA) RemoveSignalsObserver() *BSSWPA {
 	log.Log.Debug("RemoveSignalsObserver.BSS")
 	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1.BSS',path='%s'", self.Object.Path())
-	if call := self.Interface.WPA.Connection.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, match); call.Err == nil {
-	} else {
-		self.Error = call.Err
+	if err := self.Interface.WPA.removeMatch(match); err != nil && self.Error == nil {
+		self.Error = err
 	}
 	return self
 }
@@ -0,0 +1,179 @@
+package wpa_dbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// fakeBSSObject serves BSS properties like supplicant does, one call at a time and delay each,
+// so concurrent calls only queue. BSS without properties is one which vanished.
+type fakeBSSObject struct {
+	path       dbus.ObjectPath
+	properties map[string]dbus.Variant
+	delay      time.Duration
+	server     *sync.Mutex
+	calls      *int
+}
+
+func (self *fakeBSSObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	return <-self.Go(method, flags, make(chan *dbus.Call, 1), args...).Done
+}
+
+func (self *fakeBSSObject) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	// reply is delivered as separate call, caller may still read the returned one
+	go func() {
+		reply := &dbus.Call{Path: self.path, Method: method, Args: args, Done: ch}
+		self.server.Lock()
+		time.Sleep(self.delay)
+		*self.calls++
+		self.server.Unlock()
+		if self.properties == nil {
+			reply.Err = errors.New("fi.w1.wpa_supplicant1.UnknownObject")
+		} else {
+			switch method {
+			case "org.freedesktop.DBus.Properties.Get":
+				reply.Body = []interface{}{self.properties[args[1].(string)]}
+			case "org.freedesktop.DBus.Properties.GetAll":
+				reply.Body = []interface{}{self.properties}
+			default:
+				reply.Err = fmt.Errorf("unexpected method %s", method)
+			}
+		}
+		ch <- reply
+	}()
+	return &dbus.Call{Path: self.path, Method: method, Args: args, Done: ch}
+}
+
+func (self *fakeBSSObject) GetProperty(p string) (dbus.Variant, error) {
+	return self.properties[p[strings.LastIndex(p, ".")+1:]], nil
+}
+
+func (self *fakeBSSObject) Destination() string {
+	return "fi.w1.wpa_supplicant1"
+}
+
+func (self *fakeBSSObject) Path() dbus.ObjectPath {
+	return self.path
+}
+
+func fakeBSSProperties(index int) map[string]dbus.Variant {
+	return map[string]dbus.Variant{
+		"BSSID": dbus.MakeVariant([]byte{0x02, 0x00, 0x00, 0x00, 0x00, byte(index)}),
+		"SSID":  dbus.MakeVariant([]byte(fmt.Sprintf("network-%d", index))),
+		"WPA":   dbus.MakeVariant(map[string]dbus.Variant{"KeyMgmt": dbus.MakeVariant([]string{})}),
+		"RSN": dbus.MakeVariant(map[string]dbus.Variant{
+			"KeyMgmt":   dbus.MakeVariant([]string{"wpa-psk", "sae"}),
+			"Pairwise":  dbus.MakeVariant([]string{"ccmp"}),
+			"Group":     dbus.MakeVariant("ccmp"),
+			"MgmtGroup": dbus.MakeVariant("aes128cmac"),
+		}),
+		"WPS":       dbus.MakeVariant(map[string]dbus.Variant{"Type": dbus.MakeVariant("pbc")}),
+		"Frequency": dbus.MakeVariant(uint16(2437)),
+		"Signal":    dbus.MakeVariant(int16(-48)),
+		"Age":       dbus.MakeVariant(uint32(3)),
+		"Mode":      dbus.MakeVariant("infrastructure"),
+		"Privacy":   dbus.MakeVariant(true),
+		"IEs":       dbus.MakeVariant([]byte{0x00, 0x03, 'a', 'b', 'c'}),
+	}
+}
+
+// fakeInterface has count BSSs, BSSs listed in gone vanish before their properties are read.
+func fakeInterface(count int, delay time.Duration, gone ...int) (iface *InterfaceWPA, calls *int) {
+	iface = &InterfaceWPA{WPA: &WPA{Context: context.Background()}}
+	calls = new(int)
+	server := &sync.Mutex{}
+	for i := 0; i < count; i++ {
+		object := &fakeBSSObject{path: dbus.ObjectPath(fmt.Sprintf("/fi/w1/wpa_supplicant1/Interfaces/0/BSSs/%d", i)),
+			properties: fakeBSSProperties(i), delay: delay, server: server, calls: calls}
+		for _, index := range gone {
+			if index == i {
+				object.properties = nil
+			}
+		}
+		iface.BSSs = append(iface.BSSs, BSSWPA{Interface: iface, Object: object})
+	}
+	return
+}
+
+func TestBSSReadProperties(t *testing.T) {
+	iface, calls := fakeInterface(1, 0)
+	bss := &iface.BSSs[0]
+	if bss.ReadProperties(); bss.Error != nil {
+		t.Fatal(bss.Error)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d, want 1", *calls)
+	}
+	chained := BSSWPA{Interface: iface, Object: bss.Object}
+	chained.ReadBSSID().ReadSSID().ReadWPA().ReadRSN().ReadWPS().ReadFrequency().ReadSignal().ReadAge().ReadMode().
+		ReadPrivacy().ReadIEs()
+	if chained.Error != nil {
+		t.Fatal(chained.Error)
+	}
+	got := fmt.Sprintf("%v %v %v %v %v %v %v %v %v %v %v %v %v %v %v", bss.BSSID, bss.SSID, bss.WPAKeyMgmt, bss.RSNKeyMgmt,
+		bss.RSNPairwise, bss.RSNGroup, bss.RSNMgmtGroup, bss.WPS, bss.Frequency, bss.Signal, bss.Age, bss.Mode, bss.Privacy,
+		bss.IEs, bss.WPAPairwise)
+	want := fmt.Sprintf("%v %v %v %v %v %v %v %v %v %v %v %v %v %v %v", chained.BSSID, chained.SSID, chained.WPAKeyMgmt,
+		chained.RSNKeyMgmt, chained.RSNPairwise, chained.RSNGroup, chained.RSNMgmtGroup, chained.WPS, chained.Frequency,
+		chained.Signal, chained.Age, chained.Mode, chained.Privacy, chained.IEs, chained.WPAPairwise)
+	if got != want {
+		t.Errorf("GetAll decoded\n%s\nchained Get decoded\n%s", got, want)
+	}
+	if bss.BSSID != "020000000000" || bss.SSID != "network-0" || bss.RSNGroup != "ccmp" || bss.Frequency != 2437 {
+		t.Errorf("unexpected BSS %s", got)
+	}
+}
+
+func TestReadBSSListPropertiesKeepsErrorOfVanishedBSS(t *testing.T) {
+	iface, calls := fakeInterface(20, time.Millisecond, 3, 17)
+	if iface.ReadBSSListProperties(); iface.Error != nil {
+		t.Fatal(iface.Error)
+	}
+	if *calls != 20 {
+		t.Errorf("calls = %d, want 20", *calls)
+	}
+	for i, bss := range iface.BSSs {
+		if vanished := i == 3 || i == 17; vanished != (bss.Error != nil) {
+			t.Errorf("BSS %d error = %v", i, bss.Error)
+		} else if !vanished && bss.SSID != fmt.Sprintf("network-%d", i) {
+			t.Errorf("BSS %d SSID = %q", i, bss.SSID)
+		}
+	}
+}
+
+// Fake bus serves calls one by one, pool is ahead of chained Get only by making fewer calls.
+const benchmarkBSSCount = 150
+
+func BenchmarkBSSChainedGet(b *testing.B) {
+	iface, _ := fakeInterface(benchmarkBSSCount, 200*time.Microsecond)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range iface.BSSs {
+			bss := BSSWPA{Interface: iface, Object: iface.BSSs[i].Object}
+			if bss.ReadBSSID().ReadSSID().ReadRSN().ReadMode().ReadSignal().
+				ReadFrequency().ReadPrivacy().ReadAge().ReadWPS().ReadWPA(); bss.Error != nil {
+				b.Fatal(bss.Error)
+			}
+		}
+	}
+}
+
+func BenchmarkBSSGetAllPool(b *testing.B) {
+	iface, _ := fakeInterface(benchmarkBSSCount, 200*time.Microsecond)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range iface.BSSs {
+			iface.BSSs[i].Error = nil
+		}
+		if iface.ReadBSSListProperties(); iface.Error != nil {
+			b.Fatal(iface.Error)
+		}
+	}
+}
@@ -2,27 +2,44 @@ package wpa_dbus
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/godbus/dbus"
 	"github.com/mark2b/wpa-connect/internal/log"
 )
 
+// bssWorkers bounds concurrent BSS property reads. Calls in flight hide bus latency between
+// calls, but supplicant serves them one by one, so more workers only queue there.
+const bssWorkers = 8
+
 type InterfaceWPA struct {
-	WPA              *WPA
-	Object           dbus.BusObject
-	Networks         []NetworkWPA
-	BSSs             []BSSWPA
-	State            string
-	Scanning         bool
-	Ifname           string
-	CurrentBSS       *BSSWPA
-	TempBSS          *BSSWPA
-	CurrentNetwork   *NetworkWPA
-	NewNetwork       *NetworkWPA
-	ScanInterval     int32
-	DisconnectReason int32
-	SignalChannel    chan *dbus.Signal
-	Error            error
+	WPA                 *WPA
+	Object              dbus.BusObject
+	Networks            []NetworkWPA
+	BSSs                []BSSWPA
+	State               string
+	Scanning            bool
+	Ifname              string
+	Driver              string
+	BridgeIfname        string
+	CurrentBSS          *BSSWPA
+	TempBSS             *BSSWPA
+	CurrentNetwork      *NetworkWPA
+	NewNetwork          *NetworkWPA
+	ScanInterval        int32
+	DisconnectReason    int32
+	KeyMgmtCapabilities []string
+	ModeCapabilities    []string
+	WPSPin              string
+	P2PGeneratedPin     string
+	P2PPeers            []PeerWPA
+	PersistentGroups    []PersistentGroupWPA
+	SignalChannel       chan *dbus.Signal
+	Error               error
+}
+
+func (self *InterfaceWPA) Detached() *InterfaceWPA {
+	return &InterfaceWPA{WPA: self.WPA.Detached(), Object: self.Object}
 }
 
 func (self *InterfaceWPA) ReadNetworksList() *InterfaceWPA {
@@ -62,11 +79,40 @@ func (self *InterfaceWPA) ReadBSSList() *InterfaceWPA {
 	return self
 }
 
+// ReadBSSListProperties reads properties of BSSs concurrently by bssWorkers calls at most. Error
+// of BSS, e.g. one which is gone since list was read, is left in its Error.
+func (self *InterfaceWPA) ReadBSSListProperties() *InterfaceWPA {
+	if self.Error == nil {
+		indexes := make(chan int)
+		var wg sync.WaitGroup
+		for i := 0; i < bssWorkers && i < len(self.BSSs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for index := range indexes {
+					self.BSSs[index].ReadProperties()
+				}
+			}()
+		}
+		for index := range self.BSSs {
+			indexes <- index
+		}
+		close(indexes)
+		wg.Wait()
+	}
+	return self
+}
+
 func (self *InterfaceWPA) Scan() *InterfaceWPA {
+	args := make(map[string]dbus.Variant, 0)
+	args["Type"] = dbus.MakeVariant("passive")
+	return self.ScanWithArgs(args)
+}
+
+// ScanWithArgs triggers scan, args are Type, SSIDs, IEs, Channels and AllowRoam of Scan method.
+func (self *InterfaceWPA) ScanWithArgs(args map[string]dbus.Variant) *InterfaceWPA {
 	if self.Error == nil {
-		args := make(map[string]dbus.Variant, 0)
-		args["Type"] = dbus.MakeVariant("passive")
-		if call := self.Object.Call("fi.w1.wpa_supplicant1.Interface.Scan", 0, args); call.Err == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.Scan", args); call.Err == nil {
 		} else {
 			self.Error = call.Err
 		}
@@ -76,7 +122,7 @@ func (self *InterfaceWPA) Scan() *InterfaceWPA {
 
 func (self *InterfaceWPA) Disconnect() *InterfaceWPA {
 	if self.Error == nil {
-		if call := self.Object.Call("fi.w1.wpa_supplicant1.Interface.Disconnect", 0); call.Err == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.Disconnect"); call.Err == nil {
 		} else {
 			self.Error = call.Err
 		}
@@ -86,7 +132,7 @@ func (self *InterfaceWPA) Disconnect() *InterfaceWPA {
 
 func (self *InterfaceWPA) Reassociate() *InterfaceWPA {
 	if self.Error == nil {
-		if call := self.Object.Call("fi.w1.wpa_supplicant1.Interface.Reassociate", 0); call.Err == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.Reassociate"); call.Err == nil {
 		} else {
 			self.Error = call.Err
 		}
@@ -96,7 +142,7 @@ func (self *InterfaceWPA) Reassociate() *InterfaceWPA {
 
 func (self *InterfaceWPA) Reattach() *InterfaceWPA {
 	if self.Error == nil {
-		if call := self.Object.Call("fi.w1.wpa_supplicant1.Interface.Reattach", 0); call.Err == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.Reattach"); call.Err == nil {
 		} else {
 			self.Error = call.Err
 		}
@@ -106,7 +152,7 @@ func (self *InterfaceWPA) Reattach() *InterfaceWPA {
 
 func (self *InterfaceWPA) Reconnect() *InterfaceWPA {
 	if self.Error == nil {
-		if call := self.Object.Call("fi.w1.wpa_supplicant1.Interface.Reconnect", 0); call.Err == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.Reconnect"); call.Err == nil {
 		} else {
 			self.Error = call.Err
 		}
@@ -116,7 +162,45 @@ func (self *InterfaceWPA) Reconnect() *InterfaceWPA {
 
 func (self *InterfaceWPA) RemoveAllNetworks() *InterfaceWPA {
 	if self.Error == nil {
-		if call := self.Object.Call("fi.w1.wpa_supplicant1.Interface.RemoveAllNetworks", 0); call.Err == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.RemoveAllNetworks"); call.Err == nil {
+		} else {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+func (self *InterfaceWPA) SaveConfig() *InterfaceWPA {
+	if self.Error == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.SaveConfig"); call.Err == nil {
+		} else {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+// StartWPS starts WPS negotiation, WPSPin is set when supplicant generated PIN.
+func (self *InterfaceWPA) StartWPS(args map[string]dbus.Variant) *InterfaceWPA {
+	if self.Error == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.WPS.Start", args); call.Err == nil {
+			if len(call.Body) > 0 {
+				if output, ok := call.Body[0].(map[string]dbus.Variant); ok {
+					if pin, ok := output["Pin"].Value().(string); ok {
+						self.WPSPin = pin
+					}
+				}
+			}
+		} else {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+func (self *InterfaceWPA) CancelWPS() *InterfaceWPA {
+	if self.Error == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.WPS.Cancel"); call.Err == nil {
 		} else {
 			self.Error = call.Err
 		}
@@ -126,7 +210,7 @@ func (self *InterfaceWPA) RemoveAllNetworks() *InterfaceWPA {
 
 func (self *InterfaceWPA) AddNetwork(args map[string]dbus.Variant) *InterfaceWPA {
 	if self.Error == nil {
-		if call := self.Object.Call("fi.w1.wpa_supplicant1.Interface.AddNetwork", 0, args); call.Err == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.AddNetwork", args); call.Err == nil {
 			if len(call.Body) > 0 {
 				networkObjectPath := call.Body[0].(dbus.ObjectPath)
 				self.NewNetwork = &NetworkWPA{Interface: self, Object: self.WPA.Connection.Object("fi.w1.wpa_supplicant1", networkObjectPath)}
@@ -171,6 +255,28 @@ func (self *InterfaceWPA) ReadIfname() *InterfaceWPA {
 	return self
 }
 
+func (self *InterfaceWPA) ReadDriver() *InterfaceWPA {
+	if self.Error == nil {
+		if value, err := self.WPA.get("fi.w1.wpa_supplicant1.Interface.Driver", self.Object); err == nil {
+			self.Driver = value.(string)
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
+
+func (self *InterfaceWPA) ReadBridgeIfname() *InterfaceWPA {
+	if self.Error == nil {
+		if value, err := self.WPA.get("fi.w1.wpa_supplicant1.Interface.BridgeIfname", self.Object); err == nil {
+			self.BridgeIfname = value.(string)
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
+
 func (self *InterfaceWPA) ReadScanInterval() *InterfaceWPA {
 	if self.Error == nil {
 		if value, err := self.WPA.get("fi.w1.wpa_supplicant1.Interface.ScanInterval", self.Object); err == nil {
@@ -193,10 +299,30 @@ func (self *InterfaceWPA) ReadDisconnectReason() *InterfaceWPA {
 	return self
 }
 
+func (self *InterfaceWPA) ReadCapabilities() *InterfaceWPA {
+	if self.Error == nil {
+		if value, err := self.WPA.get("fi.w1.wpa_supplicant1.Interface.Capabilities", self.Object); err == nil {
+			if value, ok := value.(map[string]dbus.Variant); ok {
+				for key, variant := range value {
+					switch key {
+					case "KeyMgmt":
+						self.KeyMgmtCapabilities = variant.Value().([]string)
+					case "Modes":
+						self.ModeCapabilities = variant.Value().([]string)
+					}
+				}
+			}
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
+
 func (self *InterfaceWPA) AddSignalsObserver() *InterfaceWPA {
 	log.Log.Debug("AddSignalsObserver.Interface")
 	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1.Interface',path='%s'", self.Object.Path())
-	if call := self.WPA.Connection.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, match); call.Err == nil {
+	if call := self.WPA.call(self.WPA.Connection.BusObject(), "org.freedesktop.DBus.AddMatch", match); call.Err == nil {
 	} else {
 		self.Error = call.Err
 	}
@@ -206,13 +332,50 @@ func (self *InterfaceWPA) AddSignalsObserver() *InterfaceWPA {
 func (self *InterfaceWPA) RemoveSignalsObserver() *InterfaceWPA {
 	log.Log.Debug("RemoveSignalsObserver.Interface")
 	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1.Interface',path='%s'", self.Object.Path())
-	if call := self.WPA.Connection.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, match); call.Err == nil {
+	if err := self.WPA.removeMatch(match); err != nil && self.Error == nil {
+		self.Error = err
+	}
+	return self
+}
+
+func (self *InterfaceWPA) AddWPSSignalsObserver() *InterfaceWPA {
+	log.Log.Debug("AddSignalsObserver.Interface.WPS")
+	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1.Interface.WPS',path='%s'", self.Object.Path())
+	if call := self.WPA.call(self.WPA.Connection.BusObject(), "org.freedesktop.DBus.AddMatch", match); call.Err == nil {
+	} else {
+		self.Error = call.Err
+	}
+	return self
+}
+
+func (self *InterfaceWPA) RemoveWPSSignalsObserver() *InterfaceWPA {
+	log.Log.Debug("RemoveSignalsObserver.Interface.WPS")
+	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1.Interface.WPS',path='%s'", self.Object.Path())
+	if err := self.WPA.removeMatch(match); err != nil && self.Error == nil {
+		self.Error = err
+	}
+	return self
+}
+
+func (self *InterfaceWPA) AddMeshSignalsObserver() *InterfaceWPA {
+	log.Log.Debug("AddSignalsObserver.Interface.Mesh")
+	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1.Interface.Mesh',path='%s'", self.Object.Path())
+	if call := self.WPA.call(self.WPA.Connection.BusObject(), "org.freedesktop.DBus.AddMatch", match); call.Err == nil {
 	} else {
 		self.Error = call.Err
 	}
 	return self
 }
 
+func (self *InterfaceWPA) RemoveMeshSignalsObserver() *InterfaceWPA {
+	log.Log.Debug("RemoveSignalsObserver.Interface.Mesh")
+	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1.Interface.Mesh',path='%s'", self.Object.Path())
+	if err := self.WPA.removeMatch(match); err != nil && self.Error == nil {
+		self.Error = err
+	}
+	return self
+}
+
 func (self *InterfaceWPA) ReadCurrentBSS() *InterfaceWPA {
 	if self.Error == nil {
 		if value, err := self.WPA.get("fi.w1.wpa_supplicant1.Interface.CurrentBSS", self.Object); err == nil {
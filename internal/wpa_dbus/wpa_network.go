@@ -1,7 +1,9 @@
 package wpa_dbus
 
 import (
+	"encoding/hex"
 	"fmt"
+	"strings"
 
 	"github.com/godbus/dbus"
 	"github.com/mark2b/wpa-connect/internal/log"
@@ -12,6 +14,8 @@ type NetworkWPA struct {
 	Object        dbus.BusObject
 	SSID          string
 	KeyMgmt       string
+	Properties    map[string]string
+	Enabled       bool
 	SignalChannel chan *dbus.Signal
 	Error         error
 }
@@ -20,10 +24,14 @@ func (self *NetworkWPA) ReadProperties() *NetworkWPA {
 	log.Log.Debug("ReadProperties")
 	if self.Error == nil {
 		if properties, err := self.Interface.WPA.get("fi.w1.wpa_supplicant1.Network.Properties", self.Object); err == nil {
+			self.Properties = make(map[string]string)
 			for key, value := range properties.(map[string]dbus.Variant) {
+				if value, ok := value.Value().(string); ok {
+					self.Properties[key] = value
+				}
 				switch key {
 				case "ssid":
-					self.SSID = value.Value().(string)
+					self.SSID = unquoteSSID(value.Value().(string))
 				case "key_mgmt":
 					self.KeyMgmt = value.Value().(string)
 				}
@@ -35,10 +43,53 @@ func (self *NetworkWPA) ReadProperties() *NetworkWPA {
 	return self
 }
 
+func (self *NetworkWPA) SetProperties(properties map[string]dbus.Variant) *NetworkWPA {
+	log.Log.Debug("SetProperties")
+	if self.Error == nil {
+		if err := self.Interface.WPA.set("fi.w1.wpa_supplicant1.Network.Properties", self.Object, properties); err != nil {
+			self.Error = err
+		}
+	}
+	return self
+}
+
+func (self *NetworkWPA) ReadEnabled() *NetworkWPA {
+	if self.Error == nil {
+		if value, err := self.Interface.WPA.get("fi.w1.wpa_supplicant1.Network.Enabled", self.Object); err == nil {
+			self.Enabled = value.(bool)
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
+
+func (self *NetworkWPA) SetEnabled(enabled bool) *NetworkWPA {
+	if self.Error == nil {
+		if err := self.Interface.WPA.set("fi.w1.wpa_supplicant1.Network.Enabled", self.Object, enabled); err == nil {
+			self.Enabled = enabled
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
+
+func (self *NetworkWPA) Remove() *NetworkWPA {
+	log.Log.Debug("Remove")
+	if self.Error == nil {
+		if call := self.Interface.WPA.call(self.Interface.Object, "fi.w1.wpa_supplicant1.Interface.RemoveNetwork", self.Object.Path()); call.Err == nil {
+		} else {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
 func (self *NetworkWPA) Select() *NetworkWPA {
 	log.Log.Debug("Select")
 	if self.Error == nil {
-		if call := self.Interface.Object.Call("fi.w1.wpa_supplicant1.Interface.SelectNetwork", 0, self.Object.Path()); call.Err == nil {
+		if call := self.Interface.WPA.call(self.Interface.Object, "fi.w1.wpa_supplicant1.Interface.SelectNetwork", self.Object.Path()); call.Err == nil {
 		} else {
 			self.Error = call.Err
 		}
@@ -49,7 +100,7 @@ func (self *NetworkWPA) Select() *NetworkWPA {
 func (self *NetworkWPA) AddSignalsObserver() *NetworkWPA {
 	log.Log.Debug("AddSignalsObserver.Network")
 	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1.Network',path='%s'", self.Object.Path())
-	if call := self.Interface.WPA.Connection.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, match); call.Err == nil {
+	if call := self.Interface.WPA.call(self.Interface.WPA.Connection.BusObject(), "org.freedesktop.DBus.AddMatch", match); call.Err == nil {
 	} else {
 		self.Error = call.Err
 	}
@@ -59,9 +110,19 @@ func (self *NetworkWPA) AddSignalsObserver() *NetworkWPA {
 func (self *NetworkWPA) RemoveSignalsObserver() *NetworkWPA {
 	log.Log.Debug("RemoveSignalsObserver.Network")
 	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1.Network',path='%s'", self.Object.Path())
-	if call := self.Interface.WPA.Connection.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, match); call.Err == nil {
-	} else {
-		self.Error = call.Err
+	if err := self.Interface.WPA.removeMatch(match); err != nil && self.Error == nil {
+		self.Error = err
 	}
 	return self
 }
+
+// unquoteSSID decodes ssid as it is stored in configuration, quoted string or hex.
+func unquoteSSID(value string) string {
+	if len(value) >= 2 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+		return value[1 : len(value)-1]
+	}
+	if decoded, err := hex.DecodeString(value); err == nil {
+		return string(decoded)
+	}
+	return value
+}
@@ -0,0 +1,233 @@
+package wpa_dbus
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/godbus/dbus"
+	"github.com/mark2b/wpa-connect/internal/log"
+)
+
+type PeerWPA struct {
+	Interface     *InterfaceWPA
+	Object        dbus.BusObject
+	DeviceName    string
+	DeviceAddress string
+	Manufacturer  string
+	ModelName     string
+	ConfigMethod  uint16
+	Level         int32
+	Error         error
+}
+
+type GroupWPA struct {
+	Interface  *InterfaceWPA
+	Object     dbus.BusObject
+	Role       string
+	SSID       string
+	BSSID      string
+	Frequency  uint16
+	Passphrase string
+	Members    []dbus.ObjectPath
+	Error      error
+}
+
+type PersistentGroupWPA struct {
+	Interface  *InterfaceWPA
+	Object     dbus.BusObject
+	SSID       string
+	BSSID      string
+	Properties map[string]string
+	Error      error
+}
+
+func (self *InterfaceWPA) P2PFind(args map[string]dbus.Variant) *InterfaceWPA {
+	if self.Error == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.P2PDevice.Find", args); call.Err != nil {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+func (self *InterfaceWPA) P2PStopFind() *InterfaceWPA {
+	if self.Error == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.P2PDevice.StopFind"); call.Err != nil {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+// P2PConnect starts group negotiation with peer, P2PGeneratedPin is set when supplicant generated PIN.
+func (self *InterfaceWPA) P2PConnect(args map[string]dbus.Variant) *InterfaceWPA {
+	if self.Error == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.P2PDevice.Connect", args); call.Err == nil {
+			if len(call.Body) > 0 {
+				self.P2PGeneratedPin, _ = call.Body[0].(string)
+			}
+		} else {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+func (self *InterfaceWPA) P2PGroupAdd(args map[string]dbus.Variant) *InterfaceWPA {
+	if self.Error == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.P2PDevice.GroupAdd", args); call.Err != nil {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+func (self *InterfaceWPA) P2PInvite(args map[string]dbus.Variant) *InterfaceWPA {
+	if self.Error == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.P2PDevice.Invite", args); call.Err != nil {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+func (self *InterfaceWPA) P2PCancel() *InterfaceWPA {
+	if self.Error == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.P2PDevice.Cancel"); call.Err != nil {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+// P2PDisconnect terminates group, it is called on group interface.
+func (self *InterfaceWPA) P2PDisconnect() *InterfaceWPA {
+	if self.Error == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.P2PDevice.Disconnect"); call.Err != nil {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+func (self *InterfaceWPA) ReadP2PPeers() *InterfaceWPA {
+	if self.Error == nil {
+		if value, err := self.WPA.get("fi.w1.wpa_supplicant1.Interface.P2PDevice.Peers", self.Object); err == nil {
+			peers := []PeerWPA{}
+			for _, peerObjectPath := range value.([]dbus.ObjectPath) {
+				peers = append(peers, PeerWPA{Interface: self, Object: self.WPA.Connection.Object("fi.w1.wpa_supplicant1", peerObjectPath)})
+			}
+			self.P2PPeers = peers
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
+
+func (self *InterfaceWPA) ReadPersistentGroups() *InterfaceWPA {
+	if self.Error == nil {
+		if value, err := self.WPA.get("fi.w1.wpa_supplicant1.Interface.P2PDevice.PersistentGroups", self.Object); err == nil {
+			groups := []PersistentGroupWPA{}
+			for _, groupObjectPath := range value.([]dbus.ObjectPath) {
+				groups = append(groups, PersistentGroupWPA{Interface: self, Object: self.WPA.Connection.Object("fi.w1.wpa_supplicant1", groupObjectPath)})
+			}
+			self.PersistentGroups = groups
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
+
+func (self *InterfaceWPA) RemovePersistentGroup(path dbus.ObjectPath) *InterfaceWPA {
+	if self.Error == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.P2PDevice.RemovePersistentGroup", path); call.Err != nil {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+func (self *InterfaceWPA) RemoveAllPersistentGroups() *InterfaceWPA {
+	if self.Error == nil {
+		if call := self.WPA.call(self.Object, "fi.w1.wpa_supplicant1.Interface.P2PDevice.RemoveAllPersistentGroups"); call.Err != nil {
+			self.Error = call.Err
+		}
+	}
+	return self
+}
+
+func (self *InterfaceWPA) AddP2PSignalsObserver() *InterfaceWPA {
+	log.Log.Debug("AddSignalsObserver.Interface.P2PDevice")
+	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1.Interface.P2PDevice',path='%s'", self.Object.Path())
+	if call := self.WPA.call(self.WPA.Connection.BusObject(), "org.freedesktop.DBus.AddMatch", match); call.Err != nil {
+		self.Error = call.Err
+	}
+	return self
+}
+
+func (self *InterfaceWPA) RemoveP2PSignalsObserver() *InterfaceWPA {
+	log.Log.Debug("RemoveSignalsObserver.Interface.P2PDevice")
+	match := fmt.Sprintf("type='signal',interface='fi.w1.wpa_supplicant1.Interface.P2PDevice',path='%s'", self.Object.Path())
+	if err := self.WPA.removeMatch(match); err != nil && self.Error == nil {
+		self.Error = err
+	}
+	return self
+}
+
+func (self *PeerWPA) ReadProperties() *PeerWPA {
+	if self.Error == nil {
+		if properties, err := self.Interface.WPA.getAll("fi.w1.wpa_supplicant1.Peer", self.Object); err == nil {
+			self.DeviceName, _ = properties["DeviceName"].Value().(string)
+			self.Manufacturer, _ = properties["Manufacturer"].Value().(string)
+			self.ModelName, _ = properties["ModelName"].Value().(string)
+			self.ConfigMethod, _ = properties["config_method"].Value().(uint16)
+			self.Level, _ = properties["level"].Value().(int32)
+			if address, ok := properties["DeviceAddress"].Value().([]byte); ok {
+				self.DeviceAddress = net.HardwareAddr(address).String()
+			}
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
+
+func (self *GroupWPA) ReadProperties() *GroupWPA {
+	if self.Error == nil {
+		if properties, err := self.Interface.WPA.getAll("fi.w1.wpa_supplicant1.Group", self.Object); err == nil {
+			self.Role, _ = properties["Role"].Value().(string)
+			self.Frequency, _ = properties["Frequency"].Value().(uint16)
+			self.Passphrase, _ = properties["Passphrase"].Value().(string)
+			self.Members, _ = properties["Members"].Value().([]dbus.ObjectPath)
+			if ssid, ok := properties["SSID"].Value().([]byte); ok {
+				self.SSID = string(ssid)
+			}
+			if bssid, ok := properties["BSSID"].Value().([]byte); ok {
+				self.BSSID = net.HardwareAddr(bssid).String()
+			}
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
+
+func (self *PersistentGroupWPA) ReadProperties() *PersistentGroupWPA {
+	if self.Error == nil {
+		if value, err := self.Interface.WPA.get("fi.w1.wpa_supplicant1.PersistentGroup.Properties", self.Object); err == nil {
+			self.Properties = make(map[string]string)
+			for key, value := range value.(map[string]dbus.Variant) {
+				if value, ok := value.Value().(string); ok {
+					self.Properties[key] = value
+				}
+			}
+			self.SSID = unquoteSSID(self.Properties["ssid"])
+			self.BSSID = self.Properties["bssid"]
+		} else {
+			self.Error = err
+		}
+	}
+	return self
+}
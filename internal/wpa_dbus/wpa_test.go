@@ -0,0 +1,33 @@
+package wpa_dbus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCallDoesNotInvokeMethodWhenContextIsDone(t *testing.T) {
+	iface, calls := fakeInterface(1, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	iface.WPA.Context = ctx
+	bss := &iface.BSSs[0]
+	if bss.ReadProperties(); bss.Error != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", bss.Error)
+	}
+	time.Sleep(time.Millisecond * 10)
+	if *calls != 0 {
+		t.Errorf("calls = %d, want 0", *calls)
+	}
+}
+
+func TestCallAbandonedWhenContextIsDone(t *testing.T) {
+	iface, _ := fakeInterface(1, time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	iface.WPA.Context = ctx
+	bss := &iface.BSSs[0]
+	if bss.ReadProperties(); bss.Error != context.DeadlineExceeded {
+		t.Errorf("got %v, want context.DeadlineExceeded", bss.Error)
+	}
+}
@@ -0,0 +1,150 @@
+package provisioning
+
+import (
+	"encoding/json"
+	"html/template"
+	"mime"
+	"net/http"
+)
+
+// Network is scanned network offered on provisioning page.
+type Network struct {
+	SSID      string   `json:"ssid"`
+	Signal    int16    `json:"signal"`
+	Frequency uint16   `json:"frequency"`
+	KeyMgmt   []string `json:"key_mgmt"`
+	Secured   bool     `json:"secured"`
+}
+
+// Status is state of provisioning reported to page, Error describes last failed connect.
+type Status struct {
+	State string `json:"state"`
+	SSID  string `json:"ssid,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Backend serves provisioning handler. Submit must not block, connect runs after response
+// is sent as access point goes down with it.
+type Backend interface {
+	Networks() ([]Network, error)
+	Submit(ssid string, password string) error
+	Status() Status
+}
+
+type connectRequest struct {
+	SSID     string `json:"ssid"`
+	Password string `json:"password"`
+}
+
+type handler struct {
+	backend Backend
+	mux     *http.ServeMux
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(page))
+
+// NewHandler returns provisioning page on / and JSON API:
+//
+//	GET  /api/networks  scanned networks
+//	GET  /api/status    provisioning status
+//	POST /api/connect   {"ssid": "...", "password": "..."}
+func NewHandler(backend Backend) http.Handler {
+	handler := &handler{backend: backend, mux: http.NewServeMux()}
+	handler.mux.HandleFunc("/", handler.servePage)
+	handler.mux.HandleFunc("/api/networks", handler.serveNetworks)
+	handler.mux.HandleFunc("/api/status", handler.serveStatus)
+	handler.mux.HandleFunc("/api/connect", handler.serveConnect)
+	return handler
+}
+
+func (self *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.mux.ServeHTTP(w, r)
+}
+
+func (self *handler) servePage(w http.ResponseWriter, r *http.Request) {
+	// Captive portal probes of clients land here too, any path gets the page
+	var submitted bool
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := self.backend.Submit(r.FormValue("ssid"), r.FormValue("password")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		submitted = true
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	networks, err := self.backend.Networks()
+	data := struct {
+		Networks  []Network
+		Status    Status
+		Submitted bool
+		ScanError error
+	}{Networks: networks, Status: self.backend.Status(), Submitted: submitted, ScanError: err}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	pageTemplate.Execute(w, data)
+}
+
+func (self *handler) serveNetworks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+	if networks, err := self.backend.Networks(); err == nil {
+		if networks == nil {
+			networks = []Network{}
+		}
+		writeJSON(w, http.StatusOK, networks)
+	} else {
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+	}
+}
+
+func (self *handler) serveStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+	writeJSON(w, http.StatusOK, self.backend.Status())
+}
+
+func (self *handler) serveConnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+	var request connectRequest
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		request = connectRequest{SSID: r.FormValue("ssid"), Password: r.FormValue("password")}
+	}
+	if err := self.backend.Submit(request.SSID, request.Password); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, self.backend.Status())
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{Error: message})
+}
@@ -0,0 +1,252 @@
+package provisioning
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	wifi "github.com/mark2b/wpa-connect"
+)
+
+type fakeScanner struct {
+	bssList []wifi.BSS
+	err     error
+}
+
+func (self *fakeScanner) ScanContext(ctx context.Context) ([]wifi.BSS, error) {
+	return self.bssList, self.err
+}
+
+// fakeConnector fails every call, handler must leave connecting to Run. Profiles are answered
+// for Run, which looks for saved networks first.
+type fakeConnector struct {
+	calls         int
+	profiles      []wifi.NetworkProfile
+	profilesError error
+}
+
+func (self *fakeConnector) ConnectContext(ctx context.Context, ssid string, credentials wifi.Credentials) (wifi.ConnectionInfo, error) {
+	self.calls++
+	return wifi.ConnectionInfo{}, errors.New("unexpected connect")
+}
+
+func (self *fakeConnector) Status() (wifi.Status, error) {
+	self.calls++
+	return wifi.Status{}, errors.New("unexpected status")
+}
+
+func (self *fakeConnector) StartAccessPoint(ctx context.Context, config wifi.AccessPointConfig) (*wifi.AccessPoint, error) {
+	self.calls++
+	return nil, errors.New("unexpected access point")
+}
+
+func (self *fakeConnector) Profiles() ([]wifi.NetworkProfile, error) {
+	return self.profiles, self.profilesError
+}
+
+var scannedBSSs = []wifi.BSS{
+	{SSID: "office", Signal: -70, Frequency: 2412, KeyMgmt: []string{"wpa-psk"}},
+	{SSID: "cafe", Signal: -50, Frequency: 2437},
+	{SSID: "", Signal: -30, Frequency: 2462},
+	{SSID: "office", Signal: -40, Frequency: 5180, KeyMgmt: []string{"wpa-psk", "sae"}},
+	{SSID: "<script>", Signal: -80, Frequency: 2412, Privacy: true},
+}
+
+// newTestProvisioner returns provisioner with access point up, as Run leaves it while it
+// waits for credentials.
+func newTestProvisioner(scanner *fakeScanner) (*Provisioner, *fakeConnector) {
+	connector := &fakeConnector{}
+	provisioner := New("wlan0", wifi.AccessPointConfig{SSID: "setup"})
+	provisioner.Manager = connector
+	provisioner.Scanner = scanner
+	provisioner.submitted = make(chan credentials, 1)
+	provisioner.scan(context.Background())
+	provisioner.setState(StateAccessPoint, "", nil)
+	return provisioner, connector
+}
+
+func serve(handler http.Handler, method string, target string, contentType string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestHandlerPage(t *testing.T) {
+	provisioner, connector := newTestProvisioner(&fakeScanner{bssList: scannedBSSs})
+	handler := NewHandler(provisioner)
+	for _, target := range []string{"/", "/generate_204", "/hotspot-detect.html"} {
+		response := serve(handler, http.MethodGet, target, "", "")
+		if response.Code != http.StatusOK || !strings.HasPrefix(response.Header().Get("Content-Type"), "text/html") {
+			t.Fatalf("%s: got %d %s", target, response.Code, response.Header().Get("Content-Type"))
+		}
+		body := response.Body.String()
+		for _, want := range []string{`<option value="office">office (-40 dBm, secured)`, `<option value="cafe">cafe (-50 dBm)`,
+			`&lt;script&gt;`, `<form method="post" action="/">`} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: page lacks %s", target, want)
+			}
+		}
+		if strings.Contains(body, "<script>") || strings.Contains(body, "Scan failed") {
+			t.Errorf("%s: unexpected page %s", target, body)
+		}
+	}
+	if response := serve(handler, http.MethodPut, "/", "", ""); response.Code != http.StatusMethodNotAllowed ||
+		response.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("PUT: got %d, Allow %q", response.Code, response.Header().Get("Allow"))
+	}
+	if connector.calls != 0 {
+		t.Errorf("handler called connector %d times", connector.calls)
+	}
+}
+
+func TestHandlerPageScanError(t *testing.T) {
+	provisioner, _ := newTestProvisioner(&fakeScanner{err: errors.New("scan_timeout")})
+	provisioner.setState(StateAccessPoint, "office", errors.New("auth_failed"))
+	body := serve(NewHandler(provisioner), http.MethodGet, "/", "", "").Body.String()
+	for _, want := range []string{"Scan failed: scan_timeout", "Last attempt to connect to office failed: auth_failed"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+}
+
+func TestHandlerPageSubmit(t *testing.T) {
+	provisioner, _ := newTestProvisioner(&fakeScanner{bssList: scannedBSSs})
+	form := url.Values{"ssid": {"office"}, "password": {"secret123"}}.Encode()
+	response := serve(NewHandler(provisioner), http.MethodPost, "/", "application/x-www-form-urlencoded", form)
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), "Setup network goes down now") {
+		t.Errorf("got %d %s", response.Code, response.Body.String())
+	}
+	if submitted := <-provisioner.submitted; submitted.ssid != "office" || submitted.password != "secret123" {
+		t.Errorf("submitted %+v", submitted)
+	}
+	form = url.Values{"ssid": {""}}.Encode()
+	if response := serve(NewHandler(provisioner), http.MethodPost, "/", "application/x-www-form-urlencoded", form); response.Code != http.StatusBadRequest ||
+		!strings.Contains(response.Body.String(), ErrInvalidSSID.Error()) {
+		t.Errorf("empty SSID: got %d %s", response.Code, response.Body.String())
+	}
+}
+
+func TestHandlerNetworks(t *testing.T) {
+	provisioner, _ := newTestProvisioner(&fakeScanner{bssList: scannedBSSs})
+	response := serve(NewHandler(provisioner), http.MethodGet, "/api/networks", "", "")
+	if response.Code != http.StatusOK || response.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got %d %s", response.Code, response.Header().Get("Content-Type"))
+	}
+	var networks []Network
+	if err := json.Unmarshal(response.Body.Bytes(), &networks); err != nil {
+		t.Fatal(err)
+	}
+	// Strongest BSS of each network first, hidden network is skipped
+	want := []Network{
+		{SSID: "office", Signal: -40, Frequency: 5180, KeyMgmt: []string{"wpa-psk", "sae"}, Secured: true},
+		{SSID: "cafe", Signal: -50, Frequency: 2437},
+		{SSID: "<script>", Signal: -80, Frequency: 2412, Secured: true},
+	}
+	if len(networks) != len(want) {
+		t.Fatalf("got %+v, want %+v", networks, want)
+	}
+	for i := range want {
+		if networks[i].SSID != want[i].SSID || networks[i].Signal != want[i].Signal || networks[i].Frequency != want[i].Frequency ||
+			networks[i].Secured != want[i].Secured || strings.Join(networks[i].KeyMgmt, ",") != strings.Join(want[i].KeyMgmt, ",") {
+			t.Errorf("network %d = %+v, want %+v", i, networks[i], want[i])
+		}
+	}
+	if response := serve(NewHandler(provisioner), http.MethodPost, "/api/networks", "", ""); response.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got %d", response.Code)
+	}
+}
+
+func TestHandlerNetworksScanError(t *testing.T) {
+	provisioner, _ := newTestProvisioner(&fakeScanner{err: errors.New("scan_timeout")})
+	response := serve(NewHandler(provisioner), http.MethodGet, "/api/networks", "", "")
+	if response.Code != http.StatusServiceUnavailable || strings.TrimSpace(response.Body.String()) != `{"error":"scan_timeout"}` {
+		t.Errorf("got %d %s", response.Code, response.Body.String())
+	}
+	provisioner, _ = newTestProvisioner(&fakeScanner{})
+	if response := serve(NewHandler(provisioner), http.MethodGet, "/api/networks", "", ""); strings.TrimSpace(response.Body.String()) != "[]" {
+		t.Errorf("no networks: got %s", response.Body.String())
+	}
+}
+
+func TestHandlerConnectValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantError   error
+	}{
+		{"empty SSID", "application/json", `{"ssid": "", "password": "secret123"}`, http.StatusBadRequest, ErrInvalidSSID},
+		{"long SSID", "application/json", `{"ssid": "` + strings.Repeat("s", 33) + `"}`, http.StatusBadRequest, ErrInvalidSSID},
+		{"short password", "application/json", `{"ssid": "office", "password": "secret1"}`, http.StatusBadRequest, ErrInvalidPassword},
+		{"long password", "application/json", `{"ssid": "office", "password": "` + strings.Repeat("p", 65) + `"}`,
+			http.StatusBadRequest, ErrInvalidPassword},
+		{"malformed JSON", "application/json", `{"ssid": `, http.StatusBadRequest, nil},
+		{"open network", "application/json", `{"ssid": "cafe"}`, http.StatusAccepted, nil},
+		{"longest SSID and password", "application/json; charset=utf-8",
+			`{"ssid": "` + strings.Repeat("s", 32) + `", "password": "` + strings.Repeat("p", 64) + `"}`, http.StatusAccepted, nil},
+		{"form", "application/x-www-form-urlencoded", "ssid=office&password=secret123", http.StatusAccepted, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provisioner, _ := newTestProvisioner(&fakeScanner{bssList: scannedBSSs})
+			response := serve(NewHandler(provisioner), http.MethodPost, "/api/connect", test.contentType, test.body)
+			var reply struct {
+				Error string `json:"error"`
+			}
+			json.Unmarshal(response.Body.Bytes(), &reply)
+			if response.Code != test.wantStatus || (test.wantError != nil && reply.Error != test.wantError.Error()) {
+				t.Errorf("got %d %s", response.Code, response.Body.String())
+			}
+			if accepted := len(provisioner.submitted) == 1; accepted != (test.wantStatus == http.StatusAccepted) {
+				t.Errorf("credentials accepted: %v", accepted)
+			}
+		})
+	}
+}
+
+func TestHandlerStatus(t *testing.T) {
+	provisioner, connector := newTestProvisioner(&fakeScanner{bssList: scannedBSSs})
+	handler := NewHandler(provisioner)
+	provisioner.setState(StateAccessPoint, "office", errors.New("auth_failed"))
+	response := serve(handler, http.MethodGet, "/api/status", "", "")
+	if response.Code != http.StatusOK ||
+		strings.TrimSpace(response.Body.String()) != `{"state":"access_point","ssid":"office","error":"auth_failed"}` {
+		t.Errorf("got %d %s", response.Code, response.Body.String())
+	}
+	response = serve(handler, http.MethodPost, "/api/connect", "application/json", `{"ssid": "home", "password": "secret123"}`)
+	if response.Code != http.StatusAccepted {
+		t.Errorf("connect: got %d %s", response.Code, response.Body.String())
+	}
+	response = serve(handler, http.MethodPost, "/api/connect", "application/json", `{"ssid": "home", "password": "secret123"}`)
+	if response.Code != http.StatusBadRequest || !strings.Contains(response.Body.String(), ErrAlreadySubmitted.Error()) {
+		t.Errorf("second connect: got %d %s", response.Code, response.Body.String())
+	}
+	// Run picks credentials up and connects with access point down
+	<-provisioner.submitted
+	provisioner.setState(StateConnecting, "home", nil)
+	if response := serve(handler, http.MethodGet, "/api/status", "", ""); strings.TrimSpace(response.Body.String()) != `{"state":"connecting","ssid":"home"}` {
+		t.Errorf("connecting: got %s", response.Body.String())
+	}
+	response = serve(handler, http.MethodPost, "/api/connect", "application/json", `{"ssid": "home", "password": "secret123"}`)
+	if response.Code != http.StatusBadRequest || !strings.Contains(response.Body.String(), ErrNotAccepting.Error()) {
+		t.Errorf("connect while connecting: got %d %s", response.Code, response.Body.String())
+	}
+	if response := serve(handler, http.MethodGet, "/api/connect", "", ""); response.Code != http.StatusMethodNotAllowed ||
+		response.Header().Get("Allow") != "POST" {
+		t.Errorf("GET connect: got %d", response.Code)
+	}
+	if connector.calls != 0 {
+		t.Errorf("handler called connector %d times", connector.calls)
+	}
+}
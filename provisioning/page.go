@@ -0,0 +1,38 @@
+package provisioning
+
+// page is rendered with scanned networks and status, it works without JavaScript.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Wi-Fi setup</title>
+<style>
+body { font-family: sans-serif; max-width: 28em; margin: 1em auto; padding: 0 1em; }
+label, input, select, button { display: block; width: 100%; box-sizing: border-box; margin: .3em 0; }
+input, select, button { padding: .5em; font-size: 1em; }
+.error { color: #b00; }
+.notice { color: #070; }
+</style>
+</head>
+<body>
+<h1>Wi-Fi setup</h1>
+{{if .Submitted}}
+<p class="notice">Connecting to {{.Status.SSID}}. Setup network goes down now, it comes back if connection fails.</p>
+{{else}}
+{{if .Status.Error}}<p class="error">Last attempt{{if .Status.SSID}} to connect to {{.Status.SSID}}{{end}} failed: {{.Status.Error}}</p>{{end}}
+{{if .ScanError}}<p class="error">Scan failed: {{.ScanError}}</p>{{end}}
+<form method="post" action="/">
+<label for="ssid">Network</label>
+<input id="ssid" name="ssid" list="networks" required autocomplete="off">
+<datalist id="networks">
+{{range .Networks}}<option value="{{.SSID}}">{{.SSID}} ({{.Signal}} dBm{{if .Secured}}, secured{{end}})</option>
+{{end}}</datalist>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="off">
+<button type="submit">Connect</button>
+</form>
+{{end}}
+</body>
+</html>
+`
@@ -0,0 +1,287 @@
+package provisioning
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	wifi "github.com/mark2b/wpa-connect"
+	"github.com/mark2b/wpa-connect/internal/log"
+)
+
+type State int
+
+const (
+	StateWaitingForNetwork State = iota
+	StateAccessPoint
+	StateConnecting
+	StateConnected
+)
+
+func (self State) String() string {
+	switch self {
+	case StateWaitingForNetwork:
+		return "waiting_for_network"
+	case StateAccessPoint:
+		return "access_point"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	}
+	return "unknown"
+}
+
+const (
+	defaultListenAddress      = ":80"
+	defaultSavedNetworkWindow = time.Second * 60
+	defaultConnectTimeout     = time.Second * 60
+	scanTimeout               = time.Second * 30
+	shutdownTimeout           = time.Second * 5
+	statusPollInterval        = time.Second
+)
+
+var (
+	ErrInvalidSSID      = errors.New("invalid_ssid")
+	ErrInvalidPassword  = errors.New("invalid_password")
+	ErrNotAccepting     = errors.New("not_accepting_credentials")
+	ErrAlreadySubmitted = errors.New("already_submitted")
+)
+
+// Connector is connect manager of wpaconnect, e.g. wpaconnect.NewConnectManager("wlan0").
+type Connector interface {
+	ConnectContext(ctx context.Context, ssid string, credentials wifi.Credentials) (wifi.ConnectionInfo, error)
+	Status() (wifi.Status, error)
+	StartAccessPoint(ctx context.Context, config wifi.AccessPointConfig) (*wifi.AccessPoint, error)
+	Profiles() ([]wifi.NetworkProfile, error)
+}
+
+// Scanner is scan manager of wpaconnect, e.g. wpaconnect.NewScanManager("wlan0").
+type Scanner interface {
+	ScanContext(ctx context.Context) ([]wifi.BSS, error)
+}
+
+type credentials struct {
+	ssid     string
+	password string
+}
+
+// Provisioner brings headless device online. It waits SavedNetworkWindow for saved network,
+// then raises access point with provisioning page on ListenAddress. Submitted network is
+// connected with access point down, access point is raised again when connect fails.
+// Networks are scanned before access point is raised, interface can't scan in AP mode.
+type Provisioner struct {
+	sync.Mutex
+	NetInterface       string
+	AccessPoint        wifi.AccessPointConfig
+	ListenAddress      string
+	SavedNetworkWindow time.Duration
+	ConnectTimeout     time.Duration
+	Manager            Connector
+	Scanner            Scanner
+	OnStateChanged     func(State)
+	state              State
+	ssid               string
+	lastError          error
+	networks           []Network
+	scanError          error
+	submitted          chan credentials
+}
+
+func New(netInterface string, accessPoint wifi.AccessPointConfig) *Provisioner {
+	return &Provisioner{NetInterface: netInterface, AccessPoint: accessPoint, ListenAddress: defaultListenAddress,
+		SavedNetworkWindow: defaultSavedNetworkWindow, ConnectTimeout: defaultConnectTimeout,
+		Manager: wifi.NewConnectManager(netInterface), Scanner: wifi.NewScanManager(netInterface)}
+}
+
+// Run provisions interface until it is connected or ctx is done.
+func (self *Provisioner) Run(ctx context.Context) (info wifi.ConnectionInfo, e error) {
+	self.Lock()
+	self.submitted = make(chan credentials, 1)
+	self.Unlock()
+	self.setState(StateWaitingForNetwork, "", nil)
+	var connected bool
+	if info, connected, e = self.waitForSavedNetwork(ctx); e != nil || connected {
+		if connected {
+			self.setState(StateConnected, info.SSID, nil)
+		}
+		return
+	}
+	for {
+		var submitted credentials
+		if submitted, e = self.serveAccessPoint(ctx); e != nil {
+			return
+		}
+		connectCtx, cancel := context.WithTimeout(ctx, self.ConnectTimeout)
+		info, e = self.Manager.ConnectContext(connectCtx, submitted.ssid, wifi.Credentials{Password: submitted.password})
+		cancel()
+		if e == nil {
+			self.setState(StateConnected, submitted.ssid, nil)
+			return
+		}
+		if ctx.Err() != nil {
+			e = ctx.Err()
+			return
+		}
+		log.Log.Warning("Provisioning connect failed", submitted.ssid, e)
+		// Error is shown on page once access point is up again
+		self.Lock()
+		self.lastError = e
+		self.Unlock()
+	}
+}
+
+// waitForSavedNetwork waits until supplicant connects to one of saved networks. It does not
+// wait when there are no saved networks.
+func (self *Provisioner) waitForSavedNetwork(ctx context.Context) (info wifi.ConnectionInfo, connected bool, e error) {
+	var profiles []wifi.NetworkProfile
+	if profiles, e = self.Manager.Profiles(); e != nil || len(profiles) == 0 {
+		return
+	}
+	deadline := time.NewTimer(self.SavedNetworkWindow)
+	defer deadline.Stop()
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+	for {
+		if status, err := self.Manager.Status(); err == nil && status.State == "completed" {
+			info = wifi.ConnectionInfo{NetInterface: status.NetInterface, SSID: status.SSID}
+			for _, address := range status.Addresses {
+				if address.To4() != nil && info.IP4 == nil {
+					info.IP4 = address
+				} else if address.To4() == nil && info.IP6 == nil && !address.IsLinkLocalUnicast() {
+					info.IP6 = address
+				}
+			}
+			connected = info.IP4 != nil || info.IP6 != nil
+			if connected {
+				return
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return
+		case <-ctx.Done():
+			e = ctx.Err()
+			return
+		}
+	}
+}
+
+// serveAccessPoint raises access point with provisioning page until credentials are submitted.
+func (self *Provisioner) serveAccessPoint(ctx context.Context) (submitted credentials, e error) {
+	self.scan(ctx)
+	var ap *wifi.AccessPoint
+	if ap, e = self.Manager.StartAccessPoint(ctx, self.AccessPoint); e != nil {
+		return
+	}
+	defer ap.Stop()
+	var listener net.Listener
+	if listener, e = net.Listen("tcp", self.ListenAddress); e != nil {
+		return
+	}
+	server := &http.Server{Handler: NewHandler(self)}
+	go server.Serve(listener)
+	self.Lock()
+	ssid, lastError := self.ssid, self.lastError
+	self.Unlock()
+	self.setState(StateAccessPoint, ssid, lastError)
+	select {
+	case submitted = <-self.submitted:
+		self.setState(StateConnecting, submitted.ssid, nil)
+	case <-ctx.Done():
+		e = ctx.Err()
+	}
+	// Response to submit is finished before access point goes down
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	return
+}
+
+// scan keeps strongest BSS of each network, hidden networks are skipped.
+func (self *Provisioner) scan(ctx context.Context) {
+	scanCtx, cancel := context.WithTimeout(ctx, scanTimeout)
+	defer cancel()
+	bssList, err := self.Scanner.ScanContext(scanCtx)
+	networks := []Network{}
+	indexes := map[string]int{}
+	for _, bss := range bssList {
+		if bss.SSID == "" {
+			continue
+		}
+		network := Network{SSID: bss.SSID, Signal: bss.Signal, Frequency: bss.Frequency, KeyMgmt: bss.KeyMgmt,
+			Secured: bss.Privacy || len(bss.KeyMgmt) > 0}
+		if i, ok := indexes[bss.SSID]; !ok {
+			indexes[bss.SSID] = len(networks)
+			networks = append(networks, network)
+		} else if networks[i].Signal < network.Signal {
+			networks[i] = network
+		}
+	}
+	sort.SliceStable(networks, func(i, j int) bool {
+		return networks[i].Signal > networks[j].Signal
+	})
+	self.Lock()
+	defer self.Unlock()
+	if err == nil || len(networks) > 0 {
+		self.networks = networks
+	}
+	self.scanError = err
+}
+
+func (self *Provisioner) Networks() ([]Network, error) {
+	self.Lock()
+	defer self.Unlock()
+	if self.networks == nil {
+		return nil, self.scanError
+	}
+	return self.networks, nil
+}
+
+// Submit hands credentials over to Run, it is accepted only while access point is up.
+func (self *Provisioner) Submit(ssid string, password string) error {
+	if len(ssid) == 0 || len(ssid) > 32 {
+		return ErrInvalidSSID
+	}
+	if password != "" && (len(password) < 8 || len(password) > 64) {
+		return ErrInvalidPassword
+	}
+	self.Lock()
+	defer self.Unlock()
+	if self.state != StateAccessPoint || self.submitted == nil {
+		return ErrNotAccepting
+	}
+	select {
+	case self.submitted <- credentials{ssid: ssid, password: password}:
+		return nil
+	default:
+		return ErrAlreadySubmitted
+	}
+}
+
+func (self *Provisioner) Status() Status {
+	self.Lock()
+	defer self.Unlock()
+	status := Status{State: self.state.String(), SSID: self.ssid}
+	if self.lastError != nil {
+		status.Error = self.lastError.Error()
+	}
+	return status
+}
+
+func (self *Provisioner) setState(state State, ssid string, lastError error) {
+	self.Lock()
+	changed := self.state != state
+	self.state = state
+	self.ssid = ssid
+	self.lastError = lastError
+	self.Unlock()
+	if changed && self.OnStateChanged != nil {
+		self.OnStateChanged(state)
+	}
+}
@@ -0,0 +1,40 @@
+package provisioning
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	wifi "github.com/mark2b/wpa-connect"
+)
+
+func TestRunSavedNetworks(t *testing.T) {
+	errSupplicant := errors.New("supplicant is not running")
+	// Profiles can't be listed, Run must not go on as if there were no saved networks
+	provisioner, connector := newTestProvisioner(&fakeScanner{})
+	connector.profilesError = errSupplicant
+	if _, err := provisioner.Run(context.Background()); err != errSupplicant {
+		t.Errorf("got %v, want %v", err, errSupplicant)
+	}
+	if connector.calls != 0 {
+		t.Errorf("got %d calls after failed listing", connector.calls)
+	}
+	// Without saved networks access point is raised at once
+	provisioner, connector = newTestProvisioner(&fakeScanner{})
+	if _, err := provisioner.Run(context.Background()); err == nil || err.Error() != "unexpected access point" {
+		t.Errorf("got %v, want access point error", err)
+	}
+	if connector.calls != 1 {
+		t.Errorf("got %d calls, want StartAccessPoint only", connector.calls)
+	}
+	// Saved network is waited for, Status is polled until window is over
+	provisioner, connector = newTestProvisioner(&fakeScanner{})
+	connector.profiles = []wifi.NetworkProfile{{SSID: "office"}}
+	provisioner.SavedNetworkWindow = statusPollInterval / 2
+	if _, err := provisioner.Run(context.Background()); err == nil || err.Error() != "unexpected access point" {
+		t.Errorf("got %v, want access point error", err)
+	}
+	if connector.calls != 2 {
+		t.Errorf("got %d calls, want Status and StartAccessPoint", connector.calls)
+	}
+}
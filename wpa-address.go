@@ -0,0 +1,131 @@
+package wpaconnect
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"github.com/mark2b/wpa-connect/internal/netlink"
+)
+
+type AddressFamily int
+
+const (
+	AddressEither AddressFamily = iota
+	AddressIPv4
+	AddressIPv6
+	AddressBoth
+)
+
+// AddressReadiness tells when connection is considered ready. GlobalOnly ignores link-local
+// addresses, DefaultRoute requires default route through interface for address family.
+type AddressReadiness struct {
+	Family       AddressFamily
+	GlobalOnly   bool
+	DefaultRoute bool
+}
+
+// waitForAddress waits until interface addresses satisfy readiness. It is driven by
+// rtnetlink address and route notifications, addresses and routes are dumped again on
+// each of them, so lost notifications only trigger another check.
+func waitForAddress(ctx context.Context, netInterface string, readiness AddressReadiness) (ip4 net.IP, ip6 net.IP, e error) {
+	if netIface, err := net.InterfaceByName(netInterface); err == nil {
+		if conn, err := netlink.Dial(netlink.GroupIPv4Address | netlink.GroupIPv6Address |
+			netlink.GroupIPv4Route | netlink.GroupIPv6Route); err == nil {
+			defer conn.Close()
+			changed := make(chan bool, 1)
+			failed := make(chan error, 1)
+			go func() {
+				for {
+					if _, err := conn.Receive(); err != nil && !netlink.IsOverrun(err) {
+						failed <- err
+						return
+					}
+					select {
+					case changed <- true:
+					default:
+					}
+				}
+			}()
+			for {
+				var ready bool
+				if ip4, ip6, ready, e = readiness.check(netIface.Index); e != nil || ready {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					e = phaseError(ctx, ErrNoAddress)
+					return
+				case e = <-failed:
+					return
+				case <-changed:
+				}
+			}
+		} else {
+			e = err
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+// check returns first usable address of each family and whether readiness is satisfied.
+func (self *AddressReadiness) check(index int) (ip4 net.IP, ip6 net.IP, ready bool, e error) {
+	var addresses []netlink.Address
+	if addresses, e = netlink.ListAddresses(index); e != nil {
+		return
+	}
+	for _, address := range addresses {
+		if !self.usable(&address) {
+			continue
+		}
+		if address.IP.To4() != nil {
+			if ip4 == nil {
+				ip4 = address.IP.To4()
+			}
+		} else if ip6 == nil {
+			ip6 = address.IP
+		}
+	}
+	ready4, ready6 := ip4 != nil, ip6 != nil
+	if self.DefaultRoute && (ready4 || ready6) {
+		var routes []netlink.Route
+		if routes, e = netlink.ListRoutes(index); e != nil {
+			return
+		}
+		ready4 = ready4 && hasDefaultRoute(routes, syscall.AF_INET)
+		ready6 = ready6 && hasDefaultRoute(routes, syscall.AF_INET6)
+	}
+	switch self.Family {
+	case AddressIPv4:
+		ready = ready4
+	case AddressIPv6:
+		ready = ready6
+	case AddressBoth:
+		ready = ready4 && ready6
+	default:
+		ready = ready4 || ready6
+	}
+	return
+}
+
+// usable skips addresses which are not yet (or not anymore) valid for communication.
+func (self *AddressReadiness) usable(address *netlink.Address) bool {
+	if address.Flags&(syscall.IFA_F_TENTATIVE|syscall.IFA_F_DADFAILED) != 0 {
+		return false
+	}
+	if self.GlobalOnly && (address.Scope != syscall.RT_SCOPE_UNIVERSE || address.IP.IsLinkLocalUnicast()) {
+		return false
+	}
+	return true
+}
+
+func hasDefaultRoute(routes []netlink.Route, family int) bool {
+	for _, route := range routes {
+		if route.Family == family && route.IsDefault() {
+			return true
+		}
+	}
+	return false
+}
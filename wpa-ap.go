@@ -0,0 +1,89 @@
+package wpaconnect
+
+import (
+	"context"
+	"net"
+
+	"github.com/godbus/dbus"
+	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
+)
+
+const defaultAccessPointFrequency = 2437
+
+// AccessPointConfig describes network hosted on interface. Network is open when Password
+// is empty, WPA2-PSK otherwise. Frequency in MHz takes precedence over Channel, channel 6
+// is used when neither is set, unknown Channel fails StartAccessPoint. Address is assigned
+// to interface while access point is up, clients have to be served by DHCP server of their own.
+type AccessPointConfig struct {
+	SSID      string
+	Password  string
+	Frequency int
+	Channel   int
+	Address   *net.IPNet
+}
+
+// AccessPoint is network hosted by StartAccessPoint.
+type AccessPoint struct {
+	*hostedNetwork
+	Config AccessPointConfig
+}
+
+// StartAccessPoint switches interface to access point mode (mode=2) and waits until supplicant
+// enables it. Station networks are disabled while access point is up, Stop enables them again.
+func (self *connectManager) StartAccessPoint(ctx context.Context, config AccessPointConfig) (ap *AccessPoint, e error) {
+	var frequency int
+	if frequency, e = config.frequency(); e != nil {
+		return
+	}
+	self.removeIPConfig()
+	if wpa, err := wpa_dbus.NewWPAWithContext(ctx); err == nil {
+		if wpa.ReadInterface(self.netInterface()); wpa.Error == nil {
+			iface := wpa.Interface
+			ap = &AccessPoint{hostedNetwork: newHostedNetwork(self.netInterface(), wpa, iface, false), Config: config}
+			if e = ap.startAccessPoint(ctx, iface, frequency); e != nil {
+				ap.Stop()
+				ap = nil
+			}
+		} else {
+			e = wpa.Error
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+func (self *AccessPoint) startAccessPoint(ctx context.Context, iface *wpa_dbus.InterfaceWPA, frequency int) (e error) {
+	if iface.ReadCapabilities(); iface.Error != nil {
+		return iface.Error
+	}
+	if !containsString(iface.ModeCapabilities, "ap") {
+		return ErrModeNotSupported
+	}
+	if e = self.observe(iface); e == nil {
+		e = self.start(ctx, iface, self.Config.networkArgs(frequency), self.Config.Address, ErrAccessPointNotStarted)
+	}
+	return
+}
+
+func (self *AccessPointConfig) networkArgs(frequency int) map[string]dbus.Variant {
+	args := map[string]dbus.Variant{
+		"ssid":      dbus.MakeVariant(self.SSID),
+		"mode":      dbus.MakeVariant(2),
+		"frequency": dbus.MakeVariant(frequency),
+	}
+	if self.Password == "" {
+		args["key_mgmt"] = dbus.MakeVariant("NONE")
+	} else {
+		args["key_mgmt"] = dbus.MakeVariant("WPA-PSK")
+		args["proto"] = dbus.MakeVariant("RSN")
+		args["pairwise"] = dbus.MakeVariant("CCMP")
+		args["group"] = dbus.MakeVariant("CCMP")
+		args["psk"] = dbus.MakeVariant(self.Password)
+	}
+	return args
+}
+
+func (self *AccessPointConfig) frequency() (int, error) {
+	return hostedFrequency(self.Frequency, self.Channel)
+}
@@ -1,10 +1,10 @@
 package wpaconnect
 
 import (
+	"context"
 	"errors"
-	"github.com/mark2b/wpa-connect/internal/wpa_cli"
+	"sync"
 
-	"fmt"
 	"github.com/godbus/dbus"
 	"github.com/mark2b/wpa-connect/internal/log"
 	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
@@ -13,46 +13,61 @@ import (
 )
 
 func (self *connectManager) Connect(ssid string, password string, timeout time.Duration) (connectionInfo ConnectionInfo, e error) {
-	self.deadTime = time.Now().Add(timeout)
+	return self.ConnectWithCredentials(ssid, Credentials{Password: password}, timeout)
+}
+
+func (self *connectManager) ConnectWithCredentials(ssid string, credentials Credentials, timeout time.Duration) (connectionInfo ConnectionInfo, e error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return self.ConnectContext(ctx, ssid, credentials)
+}
+
+// ConnectContext connects to ssid and waits for IP address until ctx is done. On cancellation
+// signal observers are removed and ctx.Err() is returned.
+func (self *connectManager) ConnectContext(ctx context.Context, ssid string, credentials Credentials) (connectionInfo ConnectionInfo, e error) {
+	self.removeIPConfig()
 	self.context = &connectContext{}
-	self.context.scanDone = make(chan bool)
-	self.context.connectDone = make(chan bool)
-	if wpa, err := wpa_dbus.NewWPA(); err == nil {
+	self.context.scanDone = make(chan bool, 1)
+	self.context.connectDone = make(chan bool, 1)
+	if wpa, err := wpa_dbus.NewWPAWithContext(ctx); err == nil {
 		wpa.WaitForSignals(self.onSignal)
 		wpa.AddSignalsObserver()
-		if wpa.ReadInterface(self.NetInterface); wpa.Error == nil {
+		if credentials.EAP != nil {
+			if wpa.ReadEapMethods(); wpa.Error == nil {
+				if err := credentials.EAP.checkSupported(wpa.EapMethods); err != nil {
+					wpa.Error = err
+				}
+			}
+		}
+		if wpa.ReadInterface(self.netInterface()); wpa.Error == nil {
 			iface := wpa.Interface
+			self.context.setInterface(iface.Object.Path())
 			iface.AddSignalsObserver()
-			self.context.phaseWaitForScanDone = true
-			go func() {
-				time.Sleep(self.deadTime.Sub(time.Now()))
-				self.context.scanDone <- false
-				self.context.error = errors.New("timeout")
-			}()
+			self.context.setPhase(&self.context.phaseWaitForScanDone, true)
 			if iface.Scan(); iface.Error == nil {
 				// Wait for scan done
-				if <-self.context.scanDone; self.context.error == nil {
-					if iface.ReadBSSList(); iface.Error == nil {
+				if e = self.context.wait(ctx, self.context.scanDone, ErrScanTimeout); e == nil {
+					if iface.ReadBSSList().ReadBSSListProperties(); iface.Error == nil {
 						bssMap := make(map[string]wpa_dbus.BSSWPA, 0)
 						for _, bss := range iface.BSSs {
-							if bss.ReadSSID(); bss.Error == nil {
+							// BSS gone since list was read is skipped
+							if bss.Error == nil {
 								bssMap[bss.SSID] = bss
 								log.Log.Debug(bss.SSID, bss.BSSID)
-							} else {
-								e = err
+							} else if ctx.Err() != nil {
+								e = ctx.Err()
 								break
 							}
 						}
 						if e == nil {
-							_, exists := bssMap[ssid]
-							if err := self.connectToBSS(&wpa_dbus.BSSWPA{
-								SSID: ssid,
-							}, iface, password, !exists); err == nil {
+							bss, exists := bssMap[ssid]
+							if !exists {
+								bss = wpa_dbus.BSSWPA{SSID: ssid}
+							}
+							if err := self.connectToBSS(ctx, &bss, iface, credentials, !exists); err == nil {
 								// Connected, save configuration
-								cli := wpa_cli.WPACli{NetInterface: self.NetInterface}
-								if err := cli.SaveConfig(); err == nil {
-									connectionInfo = ConnectionInfo{NetInterface: self.NetInterface, SSID: ssid,
-										IP4: self.context.ip4, IP6: self.context.ip6}
+								if err := self.saveConfig(iface); err == nil {
+									connectionInfo = self.connectionInfo(ctx, ssid)
 								} else {
 									e = err
 								}
@@ -63,11 +78,9 @@ func (self *connectManager) Connect(ssid string, password string, timeout time.D
 					} else {
 						e = iface.Error
 					}
-				} else {
-					e = self.context.error
 				}
 			} else {
-				e = wpa.Error
+				e = iface.Error
 			}
 			iface.RemoveSignalsObserver()
 		} else {
@@ -78,57 +91,125 @@ func (self *connectManager) Connect(ssid string, password string, timeout time.D
 	} else {
 		e = err
 	}
+	if e != nil {
+		self.removeIPConfig()
+	}
 	return
 }
 
-func (self *connectManager) connectToBSS(bss *wpa_dbus.BSSWPA, iface *wpa_dbus.InterfaceWPA, password string, isHidden bool) (e error) {
-	addNetworkArgs := map[string]dbus.Variant{
-		"ssid": dbus.MakeVariant(bss.SSID),
-	}
-	if isHidden {
-		addNetworkArgs["scan_ssid"] = dbus.MakeVariant(1)
+func (self *connectManager) connectToBSS(ctx context.Context, bss *wpa_dbus.BSSWPA, iface *wpa_dbus.InterfaceWPA, credentials Credentials, isHidden bool) (e error) {
+	var addNetworkArgs map[string]dbus.Variant
+	if addNetworkArgs, e = networkArgsForInterface(iface, bss, credentials, isHidden); e != nil {
+		return
 	}
-	if password == "" {
-		addNetworkArgs["key_mgmt"] = dbus.MakeVariant("NONE")
-	} else {
-		addNetworkArgs["psk"] = dbus.MakeVariant(password)
-	}
-	if iface.RemoveAllNetworks().AddNetwork(addNetworkArgs); iface.Error == nil {
-		network := iface.NewNetwork
-		self.context.phaseWaitForInterfaceConnected = true
-		go func() {
-			time.Sleep(self.deadTime.Sub(time.Now()))
-			self.context.connectDone <- false
-			self.context.error = errors.New("timeout")
-		}()
-		if network.Select(); network.Error == nil {
-			if connected := <-self.context.connectDone; self.context.error == nil {
-				if connected {
-					if err := self.readNetAddress(); err == nil {
-					} else {
-						e = err
-					}
-				} else {
-					if iface.ReadDisconnectReason(); iface.Error == nil {
-						e = errors.New(fmt.Sprintf("connection_failed, reason=%d", iface.DisconnectReason))
+	if networks, err := readNetworks(iface); err == nil {
+		// Saved profile for ssid is kept intact until new credentials are proven to work
+		if iface.AddNetwork(addNetworkArgs); iface.Error == nil {
+			network := iface.NewNetwork
+			self.context.setPhase(&self.context.phaseWaitForInterfaceConnected, true)
+			if network.Select(); network.Error == nil {
+				if e = self.context.wait(ctx, self.context.connectDone, ErrAssociationTimeout); e == nil {
+					if self.context.connected {
+						e = self.configureAddress(ctx)
 					} else {
-						e = errors.New("connection_failed")
+						e = self.context.failure
 					}
+				} else if errors.Is(e, ErrAssociationTimeout) && !self.context.hasAssociationStarted() {
+					// Supplicant never found network to associate with
+					e = phaseError(ctx, ErrNetworkNotFound)
 				}
 			} else {
-				e = self.context.error
+				e = network.Error
 			}
+			restoreNetworks(iface.Detached(), networks, network, bss.SSID, e == nil)
 		} else {
-			e = network.Error
+			e = iface.Error
+			if ctx.Err() != nil {
+				removeAbandonedNetworks(iface.Detached(), networks, bss.SSID)
+			}
 		}
 	} else {
-		e = iface.Error
+		e = err
+	}
+	return
+}
+
+// restoreNetworks undoes side effects of SelectNetwork, which disables all other networks.
+// selected is network added by caller for ssid. When connected, it replaces profiles saved
+// for ssid before, otherwise it is removed and saved profiles are left as they were.
+func restoreNetworks(iface *wpa_dbus.InterfaceWPA, networks []wpa_dbus.NetworkWPA, selected *wpa_dbus.NetworkWPA, ssid string, connected bool) {
+	for _, network := range networks {
+		restored := wpa_dbus.NetworkWPA{Interface: iface, Object: network.Object}
+		if connected && network.SSID == ssid {
+			if restored.Remove(); restored.Error != nil {
+				log.Log.Warning("Can't remove replaced network", network.SSID, restored.Error)
+			}
+		} else if network.Enabled {
+			if restored.SetEnabled(true); restored.Error != nil {
+				log.Log.Warning("Can't enable network", network.SSID, restored.Error)
+			}
+		}
+	}
+	if !connected {
+		failed := wpa_dbus.NetworkWPA{Interface: iface, Object: selected.Object}
+		if failed.Remove(); failed.Error != nil {
+			log.Log.Warning("Can't remove network", ssid, failed.Error)
+		}
+	}
+}
+
+// removeAbandonedNetworks removes networks for ssid missing in networks read before AddNetwork.
+// AddNetwork cancelled while waiting for reply may still have been applied by supplicant.
+func removeAbandonedNetworks(iface *wpa_dbus.InterfaceWPA, networks []wpa_dbus.NetworkWPA, ssid string) {
+	current, err := readNetworks(iface)
+	if err != nil {
+		log.Log.Warning("Can't read networks", err)
+		return
+	}
+	for _, network := range current {
+		if network.SSID != ssid {
+			continue
+		}
+		known := false
+		for _, previous := range networks {
+			known = known || previous.Object.Path() == network.Object.Path()
+		}
+		if !known {
+			if network.Remove(); network.Error != nil {
+				log.Log.Warning("Can't remove network", ssid, network.Error)
+			}
+		}
+	}
+}
+
+// networkArgsForInterface builds AddNetwork arguments, key management is resolved
+// against capabilities of interface and security of scanned BSS.
+func networkArgsForInterface(iface *wpa_dbus.InterfaceWPA, bss *wpa_dbus.BSSWPA, credentials Credentials, isHidden bool) (args map[string]dbus.Variant, e error) {
+	keyMgmt := KeyMgmtAuto
+	if credentials.EAP == nil {
+		if iface.ReadCapabilities(); iface.Error == nil {
+			if keyMgmt, e = credentials.resolveKeyMgmt(bssSecurity(bss), iface.KeyMgmtCapabilities); e != nil {
+				return
+			}
+		} else {
+			e = iface.Error
+			return
+		}
+	}
+	args = credentials.networkArgs(bss.SSID, keyMgmt)
+	if isHidden {
+		args["scan_ssid"] = dbus.MakeVariant(1)
 	}
 	return
 }
 
+// onSignal handles signals of connected interface only, bus connection is shared with
+// watchers and other interfaces.
 func (self *connectManager) onSignal(wpa *wpa_dbus.WPA, signal *dbus.Signal) {
 	log.Log.Debug(signal.Name, signal.Path)
+	if !self.context.isInterface(signal.Path) {
+		return
+	}
 	switch signal.Name {
 	case "fi.w1.wpa_supplicant1.Interface.BSSAdded":
 	case "fi.w1.wpa_supplicant1.Interface.BSSRemoved":
@@ -143,77 +224,202 @@ func (self *connectManager) onSignal(wpa *wpa_dbus.WPA, signal *dbus.Signal) {
 	}
 }
 
-func (self *connectManager) readNetAddress() (e error) {
-	if netIface, err := net.InterfaceByName(self.NetInterface); err == nil {
-		for time.Now().Before(self.deadTime) && !self.context.hasIP() {
-			if addrs, err := netIface.Addrs(); err == nil {
-				for _, addr := range addrs {
-					if ip, _, err := net.ParseCIDR(addr.String()); err == nil {
-						if self.context.ip4 == nil {
-							self.context.ip4 = ip.To4()
-							continue
-						}
-						if self.context.ip6 == nil {
-							self.context.ip6 = ip.To16()
-							continue
-						}
-					} else {
-						e = err
-						return
-					}
-				}
-			} else {
-				e = err
-			}
-			time.Sleep(time.Millisecond * 500)
-		}
-		if !self.context.hasIP() {
-			e = errors.New("address_not_allocated")
-		}
-	} else {
-		e = err
+// configureAddress applies static IP configuration or starts DHCP client, then waits for
+// address readiness.
+func (self *connectManager) configureAddress(ctx context.Context) (e error) {
+	if self.StaticIP != nil {
+		self.staticIP, e = self.StaticIP.apply(self.netInterface())
+	} else if self.DHCP {
+		self.dhcp, e = startDHCP(ctx, self.netInterface(), self.DHCPResolvConf)
+	}
+	if e == nil {
+		e = self.readNetAddress(ctx)
+	}
+	return
+}
+
+func (self *connectManager) connectionInfo(ctx context.Context, ssid string) (connectionInfo ConnectionInfo) {
+	connectionInfo = ConnectionInfo{NetInterface: self.netInterface(), SSID: ssid,
+		IP4: self.context.ip4, IP6: self.context.ip6}
+	if self.staticIP != nil {
+		config := self.staticIP.config
+		connectionInfo.StaticIP = &config
+	}
+	connectionInfo.DHCPLease = self.DHCPLease()
+	if self.ReachabilityCheck != nil {
+		result := self.ReachabilityCheck.Check(ctx, self.netInterface())
+		connectionInfo.Reachability = &result
 	}
 	return
 }
 
+func (self *connectManager) readNetAddress(ctx context.Context) (e error) {
+	self.context.ip4, self.context.ip6, e = waitForAddress(ctx, self.netInterface(), self.Readiness)
+	return
+}
+
 func (self *connectManager) processScanDone(wpa *wpa_dbus.WPA, signal *dbus.Signal) {
 	log.Log.Debug("processScanDone")
-	if self.context.phaseWaitForScanDone {
-		self.context.phaseWaitForScanDone = false
-		self.context.scanDone <- true
+	if self.context.setPhase(&self.context.phaseWaitForScanDone, false) {
+		self.context.notify(self.context.scanDone)
 	}
 }
 
 func (self *connectManager) processInterfacePropertiesChanged(wpa *wpa_dbus.WPA, signal *dbus.Signal) {
 	log.Log.Debug("processInterfacePropertiesChanged")
-	log.Log.Debug("phaseWaitForInterfaceConnected", self.context.phaseWaitForInterfaceConnected)
-	if self.context.phaseWaitForInterfaceConnected {
+	if self.context.isPhase(&self.context.phaseWaitForInterfaceConnected) {
 		if len(signal.Body) > 0 {
 			properties := signal.Body[0].(map[string]dbus.Variant)
+			self.context.Lock()
+			if value, ok := properties["DisconnectReason"].Value().(int32); ok {
+				self.context.disconnectReason = value
+			}
+			if value, ok := properties["AuthStatusCode"].Value().(int32); ok {
+				self.context.authStatusCode = value
+			}
+			if value, ok := properties["AssocStatusCode"].Value().(int32); ok {
+				self.context.assocStatusCode = value
+			}
+			self.context.Unlock()
 			if stateVariant, hasState := properties["State"]; hasState {
 				if state, ok := stateVariant.Value().(string); ok {
 					log.Log.Debug("State", state)
 					if state == "completed" {
-						self.context.phaseWaitForInterfaceConnected = false
-						self.context.connectDone <- true
-						return
-					} else if state == "disconnected" {
-						//self.context.phaseWaitForInterfaceConnected = false
-						//self.context.connectDone <- false
-						return
+						if self.context.setPhase(&self.context.phaseWaitForInterfaceConnected, false) {
+							self.context.connected = true
+							self.context.notify(self.context.connectDone)
+						}
+					} else if failure := self.context.processState(state, self.handshakeFailureLimit()); failure != nil {
+						if self.context.setPhase(&self.context.phaseWaitForInterfaceConnected, false) {
+							self.context.failure = failure
+							self.context.notify(self.context.connectDone)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// processState follows supplicant state transitions and returns error once connection
+// attempts failed limit times. Drop during 4-way/group handshake or EAP exchange (associated)
+// is authentication failure when reason says credentials were rejected, otherwise it is
+// reported as DisconnectError. Drop during authenticating/associating is rejection.
+func (self *connectContext) processState(state string, limit int) (failure error) {
+	self.Lock()
+	defer self.Unlock()
+	previous := self.state
+	self.state = state
+	switch state {
+	case "authenticating", "associating":
+		self.associationStarted = true
+	case "disconnected", "inactive", "scanning":
+		switch previous {
+		case "associated", "4way_handshake", "group_handshake":
+			if self.handshakeFailures++; self.handshakeFailures >= limit {
+				if disconnect := newDisconnectError(self.disconnectReason); disconnect.Reason.IsAuthFailure() {
+					failure = &AuthError{Reason: disconnect.Reason, Attempts: self.handshakeFailures}
+				} else {
+					failure = disconnect
+				}
+			}
+		case "authenticating", "associating":
+			if self.associationFailures++; self.associationFailures >= limit {
+				if status := StatusCode(self.authStatusCode); status.IsAuthFailure() {
+					failure = &AuthError{Status: status, Attempts: self.associationFailures}
+				} else {
+					if self.assocStatusCode != 0 {
+						status = StatusCode(self.assocStatusCode)
 					}
+					failure = &AssociationRejectedError{Status: status, Attempts: self.associationFailures}
 				}
 			}
 		}
 	}
+	return
+}
+
+func (self *connectContext) hasAssociationStarted() bool {
+	self.Lock()
+	defer self.Unlock()
+	return self.associationStarted
+}
+
+// removeIPConfig removes static IP configuration and releases DHCP lease applied by Connect.
+func (self *connectManager) removeIPConfig() {
+	if self.staticIP != nil {
+		self.staticIP.remove()
+		self.staticIP = nil
+	}
+	self.stopDHCP()
+}
+
+func (self *connectManager) saveConfig(iface *wpa_dbus.InterfaceWPA) (e error) {
+	if !self.SkipSaveConfig {
+		e = saveConfig(iface)
+	}
+	return
+}
+
+func (self *connectManager) handshakeFailureLimit() int {
+	if self.HandshakeFailureLimit > 0 {
+		return self.HandshakeFailureLimit
+	}
+	return defaultHandshakeFailureLimit
+}
+
+// setPhase sets phase flag and reports whether it was changed. Signals are processed
+// in a goroutine of WPA, flags are guarded by connectContext lock.
+func (self *connectContext) setPhase(phase *bool, value bool) bool {
+	self.Lock()
+	defer self.Unlock()
+	changed := *phase != value
+	*phase = value
+	return changed
+}
+
+func (self *connectContext) setInterface(path dbus.ObjectPath) {
+	self.Lock()
+	defer self.Unlock()
+	self.path = path
+}
+
+func (self *connectContext) isInterface(path dbus.ObjectPath) bool {
+	self.Lock()
+	defer self.Unlock()
+	return self.path != "" && self.path == path
+}
+
+func (self *connectContext) isPhase(phase *bool) bool {
+	self.Lock()
+	defer self.Unlock()
+	return *phase
+}
+
+// notify never blocks, signal callback must not stall D-Bus connection.
+func (self *connectContext) notify(ch chan bool) {
+	select {
+	case ch <- true:
+	default:
+	}
 }
 
-func (self *connectContext) hasIP() bool {
-	return self.ip4 != nil && self.ip6 != nil
+func (self *connectContext) wait(ctx context.Context, ch chan bool, phaseTimeout error) (e error) {
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		e = phaseError(ctx, phaseTimeout)
+	}
+	return
 }
 
 func NewConnectManager(netInterface string) *connectManager {
-	return &connectManager{NetInterface: netInterface}
+	return &connectManager{NetInterface: netInterface, Readiness: AddressReadiness{Family: AddressEither, GlobalOnly: true}}
+}
+
+// netInterface is NetInterface, or DefaultInterface at time of call when it is empty.
+func (self *connectManager) netInterface() string {
+	return netInterfaceOrDefault(self.NetInterface)
 }
 
 type ConnectionInfo struct {
@@ -221,24 +427,59 @@ type ConnectionInfo struct {
 	SSID         string
 	IP4          net.IP
 	IP6          net.IP
+	StaticIP     *StaticIPConfig
+	DHCPLease    *DHCPLease
+	Reachability *ReachabilityResult
 }
 
 type connectContext struct {
+	sync.Mutex
+	path                           dbus.ObjectPath
 	phaseWaitForScanDone           bool
 	phaseWaitForInterfaceConnected bool
 	scanDone                       chan bool
 	connectDone                    chan bool
+	connected                      bool
+	failure                        error
+	state                          string
+	associationStarted             bool
+	handshakeFailures              int
+	associationFailures            int
+	disconnectReason               int32
+	authStatusCode                 int32
+	assocStatusCode                int32
 	ip4                            net.IP
 	ip6                            net.IP
-	error                          error
 }
 
 type connectManager struct {
 	context      *connectContext
-	deadTime     time.Time
 	NetInterface string
+	// HandshakeFailureLimit is number of failed authentication or association attempts
+	// after which Connect gives up without waiting for timeout, 2 when not set.
+	HandshakeFailureLimit int
+	// SkipSaveConfig leaves supplicant configuration file untouched, connected network
+	// is lost on supplicant restart.
+	SkipSaveConfig bool
+	// Readiness tells which addresses Connect waits for after association.
+	Readiness AddressReadiness
+	// StaticIP is applied to interface after association instead of waiting for DHCP.
+	StaticIP *StaticIPConfig
+	staticIP *appliedStaticIP
+	// DHCP runs built-in DHCPv4 client after association, for images without dhcpcd or
+	// dhclient. Lease is renewed in background and released on Disconnect. Ignored when
+	// StaticIP is set.
+	DHCP bool
+	// DHCPResolvConf is file DNS servers of lease are written to, /etc/resolv.conf when empty.
+	DHCPResolvConf string
+	dhcp           *dhcpSession
+	// ReachabilityCheck is run after address is acquired, result is reported in ConnectionInfo.
+	// Captive portal or no internet does not fail Connect. Use NewHTTPChecker for default probes.
+	ReachabilityCheck ReachabilityChecker
 }
 
+const defaultHandshakeFailureLimit = 2
+
 var (
-	ConnectManager = &connectManager{NetInterface: "wlan0"}
+	ConnectManager = NewConnectManager("")
 )
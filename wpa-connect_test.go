@@ -0,0 +1,51 @@
+package wpaconnect
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProcessState(t *testing.T) {
+	tests := []struct {
+		name             string
+		states           []string
+		disconnectReason int32
+		authStatusCode   int32
+		assocStatusCode  int32
+		want             error
+	}{
+		{"connected", []string{"authenticating", "associating", "associated", "4way_handshake", "completed"},
+			0, 0, 0, nil},
+		{"single drop", []string{"associating", "associated", "4way_handshake", "disconnected"}, 15, 0, 0, nil},
+		{"wrong password", []string{"4way_handshake", "disconnected", "4way_handshake", "disconnected"},
+			15, 0, 0, &AuthError{Reason: 15, Attempts: 2}},
+		{"locally generated", []string{"4way_handshake", "disconnected", "4way_handshake", "disconnected"},
+			-23, 0, 0, &AuthError{Reason: 23, Attempts: 2}},
+		{"not auth reason", []string{"associated", "scanning", "group_handshake", "disconnected"},
+			4, 0, 0, &DisconnectError{Reason: 4}},
+		{"rejected auth", []string{"authenticating", "disconnected", "authenticating", "disconnected"},
+			0, 15, 0, &AuthError{Status: 15, Attempts: 2}},
+		{"rejected association", []string{"associating", "disconnected", "associating", "inactive"},
+			0, 0, 17, &AssociationRejectedError{Status: 17, Attempts: 2}},
+	}
+	for _, test := range tests {
+		context := &connectContext{disconnectReason: test.disconnectReason, authStatusCode: test.authStatusCode,
+			assocStatusCode: test.assocStatusCode}
+		var failure error
+		for _, state := range test.states {
+			if failure = context.processState(state, 2); failure != nil {
+				break
+			}
+		}
+		if (failure == nil) != (test.want == nil) || (failure != nil && failure.Error() != test.want.Error()) {
+			t.Errorf("%s: got %v, want %v", test.name, failure, test.want)
+		}
+	}
+	// Only rejected credentials are reported as auth failure
+	context := &connectContext{disconnectReason: 4}
+	context.processState("4way_handshake", 1)
+	if failure := context.processState("disconnected", 1); errors.Is(failure, ErrAuthFailed) ||
+		!errors.Is(failure, ErrConnectionFailed) {
+		t.Errorf("got %v, want connection failure", failure)
+	}
+}
@@ -0,0 +1,197 @@
+package wpaconnect
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus"
+)
+
+// Credentials describes how to authenticate to a network. Leave EAP nil for open
+// and pre-shared key networks, Password is used as PSK (or SAE password) then.
+// KeyMgmt and PMF are picked from the scanned BSS when left as KeyMgmtAuto and PMFAuto.
+type Credentials struct {
+	Password string
+	EAP      *EAPCredentials
+	KeyMgmt  KeyMgmt
+	PMF      PMF
+}
+
+type KeyMgmt int
+
+const (
+	KeyMgmtAuto KeyMgmt = iota
+	KeyMgmtWPAPSK
+	KeyMgmtSAE
+	KeyMgmtSAETransition
+	// KeyMgmtOWE is Opportunistic Wireless Encryption of open network, no Password.
+	KeyMgmtOWE
+)
+
+// PMF is the Protected Management Frames (ieee80211w) setting of the network.
+type PMF int
+
+const (
+	PMFAuto PMF = iota
+	PMFDisabled
+	PMFOptional
+	PMFRequired
+)
+
+// EAPCredentials holds 802.1X settings for WPA2/WPA3-Enterprise networks.
+// Method is the outer EAP method (PEAP, TTLS, TLS, ...), Phase2 is passed as is,
+// e.g. "auth=MSCHAPV2" or "autheap=GTC".
+type EAPCredentials struct {
+	Method             string
+	Identity           string
+	AnonymousIdentity  string
+	Password           string
+	CACert             string
+	ClientCert         string
+	PrivateKey         string
+	PrivateKeyPassword string
+	Phase1             string
+	Phase2             string
+	DomainSuffixMatch  string
+}
+
+func (self *Credentials) networkArgs(ssid string, keyMgmt KeyMgmt) (args map[string]dbus.Variant) {
+	args = map[string]dbus.Variant{
+		"ssid": dbus.MakeVariant(ssid),
+	}
+	if self.EAP != nil {
+		self.EAP.addNetworkArgs(args)
+	} else if self.Password == "" && keyMgmt == KeyMgmtOWE {
+		args["key_mgmt"] = dbus.MakeVariant("OWE")
+		args["ieee80211w"] = dbus.MakeVariant(PMFRequired.ieee80211w())
+	} else if self.Password == "" {
+		args["key_mgmt"] = dbus.MakeVariant("NONE")
+	} else {
+		args["psk"] = dbus.MakeVariant(self.Password)
+		switch keyMgmt {
+		case KeyMgmtSAE:
+			args["key_mgmt"] = dbus.MakeVariant("SAE")
+			args["ieee80211w"] = dbus.MakeVariant(PMFRequired.ieee80211w())
+		case KeyMgmtSAETransition:
+			args["key_mgmt"] = dbus.MakeVariant("WPA-PSK WPA-PSK-SHA256 SAE")
+			args["ieee80211w"] = dbus.MakeVariant(PMFOptional.ieee80211w())
+		default:
+			args["key_mgmt"] = dbus.MakeVariant("WPA-PSK WPA-PSK-SHA256")
+		}
+	}
+	if self.PMF != PMFAuto {
+		args["ieee80211w"] = dbus.MakeVariant(self.PMF.ieee80211w())
+	}
+	return
+}
+
+// resolveKeyMgmt picks key management for the network from security of the scanned BSS,
+// SecurityUnknown for hidden networks. Transition mode is used for hidden networks when
+// interface supports SAE, so both WPA2 and WPA3 access points are reachable. OWE is used
+// for OWE network when no Password is given.
+func (self *Credentials) resolveKeyMgmt(security Security, capabilities []string) (keyMgmt KeyMgmt, e error) {
+	if self.EAP != nil {
+		return
+	}
+	if self.Password == "" {
+		if self.KeyMgmt == KeyMgmtOWE || (self.KeyMgmt == KeyMgmtAuto && security == SecurityOWE) {
+			keyMgmt = KeyMgmtOWE
+			if !containsString(capabilities, "owe") {
+				e = ErrOWENotSupported
+			}
+		}
+		return
+	}
+	saeSupported := containsString(capabilities, "sae")
+	keyMgmt = self.KeyMgmt
+	if keyMgmt == KeyMgmtAuto {
+		switch {
+		case security == SecurityUnknown && saeSupported:
+			keyMgmt = KeyMgmtSAETransition
+		case security == SecurityWPA2WPA3Transition && saeSupported:
+			keyMgmt = KeyMgmtSAETransition
+		case security == SecurityWPA3Personal:
+			keyMgmt = KeyMgmtSAE
+		default:
+			keyMgmt = KeyMgmtWPAPSK
+		}
+	}
+	if keyMgmt != KeyMgmtWPAPSK && !saeSupported {
+		e = ErrSAENotSupported
+	}
+	return
+}
+
+func (self PMF) ieee80211w() int {
+	switch self {
+	case PMFOptional:
+		return 1
+	case PMFRequired:
+		return 2
+	}
+	return 0
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *EAPCredentials) addNetworkArgs(args map[string]dbus.Variant) {
+	args["key_mgmt"] = dbus.MakeVariant("WPA-EAP WPA-EAP-SHA256")
+	args["ieee80211w"] = dbus.MakeVariant(1)
+	args["eap"] = dbus.MakeVariant(strings.ToUpper(self.Method))
+	optional := map[string]string{
+		"identity":            self.Identity,
+		"anonymous_identity":  self.AnonymousIdentity,
+		"password":            self.Password,
+		"ca_cert":             self.CACert,
+		"client_cert":         self.ClientCert,
+		"private_key":         self.PrivateKey,
+		"private_key_passwd":  self.PrivateKeyPassword,
+		"phase1":              self.Phase1,
+		"phase2":              self.Phase2,
+		"domain_suffix_match": self.DomainSuffixMatch,
+	}
+	for key, value := range optional {
+		if value != "" {
+			args[key] = dbus.MakeVariant(value)
+		}
+	}
+}
+
+// methods returns outer EAP method followed by inner EAP methods found in Phase2.
+// TTLS "auth=" values are non-EAP inner methods implemented by TTLS itself and are skipped.
+func (self *EAPCredentials) methods() (methods []string) {
+	outer := strings.ToUpper(self.Method)
+	methods = append(methods, outer)
+	for _, field := range strings.Fields(self.Phase2) {
+		if parts := strings.SplitN(field, "=", 2); len(parts) == 2 {
+			if parts[0] == "autheap" || (parts[0] == "auth" && outer != "TTLS") {
+				methods = append(methods, strings.ToUpper(strings.TrimPrefix(parts[1], "EAP-")))
+			}
+		}
+	}
+	return
+}
+
+func (self *EAPCredentials) checkSupported(eapMethods []string) (e error) {
+	if self.Method == "" {
+		return fmt.Errorf("%w, method not specified", ErrEAPMethodNotSupported)
+	}
+	supported := make(map[string]bool, len(eapMethods))
+	for _, method := range eapMethods {
+		supported[strings.ToUpper(method)] = true
+	}
+	for _, method := range self.methods() {
+		if !supported[method] {
+			e = fmt.Errorf("%w, method=%s, supported=%s", ErrEAPMethodNotSupported, method, strings.Join(eapMethods, ","))
+			return
+		}
+	}
+	return
+}
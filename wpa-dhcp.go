@@ -0,0 +1,187 @@
+package wpaconnect
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mark2b/wpa-connect/internal/dhcp4"
+	"github.com/mark2b/wpa-connect/internal/log"
+)
+
+// DHCPLease is address configuration acquired by built-in DHCP client.
+type DHCPLease struct {
+	IP         *net.IPNet
+	Router     net.IP
+	DNS        []net.IP
+	DomainName string
+	Server     net.IP
+	LeaseTime  time.Duration
+	Acquired   time.Time
+}
+
+// dhcpSession holds lease applied to interface and renews it in background until stopped.
+type dhcpSession struct {
+	sync.Mutex
+	client       *dhcp4.Client
+	netInterface string
+	resolvConf   string
+	lease        *dhcp4.Lease
+	applied      *appliedStaticIP
+	cancel       context.CancelFunc
+	done         chan bool
+}
+
+// startDHCP acquires lease, applies it to interface and starts renewal. Lease acquisition
+// is bound to ctx, renewal runs until stop is called.
+func startDHCP(ctx context.Context, netInterface string, resolvConf string) (session *dhcpSession, e error) {
+	var client *dhcp4.Client
+	if client, e = dhcp4.NewClient(netInterface); e != nil {
+		return
+	}
+	var lease *dhcp4.Lease
+	if lease, e = client.Acquire(ctx); e != nil {
+		client.Close()
+		if ctx.Err() != nil {
+			e = phaseError(ctx, ErrNoAddress)
+		}
+		return
+	}
+	session = &dhcpSession{client: client, netInterface: netInterface, resolvConf: resolvConf, done: make(chan bool)}
+	if e = session.apply(lease); e != nil {
+		client.Release(lease)
+		client.Close()
+		session = nil
+		return
+	}
+	var renewCtx context.Context
+	renewCtx, session.cancel = context.WithCancel(context.Background())
+	go session.maintain(renewCtx)
+	return
+}
+
+// maintain renews lease at T1 with server which granted it, rebinds with any server at T2
+// and starts over with new lease acquisition when lease expires or server declines it.
+func (self *dhcpSession) maintain(ctx context.Context) {
+	defer close(self.done)
+	for {
+		lease := self.currentLease()
+		if !sleepUntil(ctx, lease.Acquired.Add(lease.RenewalTime)) {
+			return
+		}
+		renewed, err := self.extend(ctx, lease, lease.Acquired.Add(lease.RebindingTime), self.client.Renew)
+		if err != nil && !errors.Is(err, dhcp4.ErrNak) {
+			renewed, err = self.extend(ctx, lease, lease.Acquired.Add(lease.LeaseTime), self.client.Rebind)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Log.Warning("DHCP lease lost", lease.IP, err)
+			self.Lock()
+			self.removeApplied()
+			self.Unlock()
+			if renewed, err = self.client.Acquire(ctx); err != nil {
+				return
+			}
+		}
+		if err = self.apply(renewed); err != nil {
+			log.Log.Warning("Can't apply DHCP lease", renewed.IP, err)
+			return
+		}
+	}
+}
+
+func (self *dhcpSession) extend(ctx context.Context, lease *dhcp4.Lease, deadline time.Time,
+	request func(context.Context, *dhcp4.Lease) (*dhcp4.Lease, error)) (*dhcp4.Lease, error) {
+	requestCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	return request(requestCtx, lease)
+}
+
+// apply configures interface with lease, configuration is replaced only when it was changed.
+func (self *dhcpSession) apply(lease *dhcp4.Lease) (e error) {
+	self.Lock()
+	defer self.Unlock()
+	config := leaseConfig(lease, self.resolvConf)
+	if self.applied == nil || !self.applied.config.equal(&config) {
+		self.removeApplied()
+		self.applied, e = config.apply(self.netInterface)
+	}
+	if e == nil {
+		self.lease = lease
+	}
+	return
+}
+
+func (self *dhcpSession) removeApplied() {
+	if self.applied != nil {
+		self.applied.remove()
+		self.applied = nil
+	}
+}
+
+func (self *dhcpSession) currentLease() *dhcp4.Lease {
+	self.Lock()
+	defer self.Unlock()
+	return self.lease
+}
+
+// stop ends renewal, releases lease and removes configuration from interface.
+func (self *dhcpSession) stop() {
+	self.cancel()
+	<-self.done
+	self.Lock()
+	defer self.Unlock()
+	if self.applied != nil {
+		if err := self.client.Release(self.lease); err != nil {
+			log.Log.Debug("Can't release DHCP lease", self.lease.IP, err)
+		}
+		self.removeApplied()
+	}
+	self.client.Close()
+}
+
+func (self *dhcpSession) dhcpLease() *DHCPLease {
+	self.Lock()
+	defer self.Unlock()
+	if self.applied == nil {
+		return nil
+	}
+	lease := self.lease
+	return &DHCPLease{IP: &net.IPNet{IP: lease.IP, Mask: lease.Mask}, Router: lease.Router, DNS: lease.DNS,
+		DomainName: lease.DomainName, Server: lease.Server, LeaseTime: lease.LeaseTime, Acquired: lease.Acquired}
+}
+
+// DHCPLease returns lease currently held by built-in DHCP client, nil when there is none.
+func (self *connectManager) DHCPLease() *DHCPLease {
+	if self.dhcp != nil {
+		return self.dhcp.dhcpLease()
+	}
+	return nil
+}
+
+func (self *connectManager) stopDHCP() {
+	if self.dhcp != nil {
+		self.dhcp.stop()
+		self.dhcp = nil
+	}
+}
+
+func leaseConfig(lease *dhcp4.Lease, resolvConf string) StaticIPConfig {
+	return StaticIPConfig{IP4: &net.IPNet{IP: lease.IP, Mask: lease.Mask}, Gateway4: lease.Router, DNS: lease.DNS,
+		ResolvConf: resolvConf}
+}
+
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
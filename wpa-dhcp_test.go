@@ -0,0 +1,247 @@
+package wpaconnect
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mark2b/wpa-connect/internal/dhcp4"
+	"github.com/mark2b/wpa-connect/internal/netlink"
+)
+
+// DHCP test runs in network namespace of its own, client end of veth pair stays there and
+// server end is moved to namespace of server process, so unicast goes over the link too.
+const (
+	dhcpTestNetns  = "WPA_CONNECT_DHCP_TEST_NETNS"
+	dhcpTestServer = "WPA_CONNECT_DHCP_TEST_SERVER"
+	dhcpClientLink = "wpatest0"
+	dhcpServerLink = "wpatest1"
+)
+
+var (
+	dhcpServerAddress = &net.IPNet{IP: net.IP{198, 51, 100, 1}, Mask: net.CIDRMask(24, 32)}
+	dhcpOfferedIP     = net.IP{198, 51, 100, 10}
+)
+
+func TestDHCPOverVeth(t *testing.T) {
+	if os.Getenv(dhcpTestNetns) == "" {
+		runInNetns(t, "TestDHCPOverVeth", dhcpTestNetns)
+		return
+	}
+	server := exec.Command("unshare", "--net", os.Args[0], "-test.run=^TestDHCPServer$")
+	server.Env = append(os.Environ(), dhcpTestServer+"=1")
+	server.Stderr = os.Stderr
+	stdout, _ := server.StdoutPipe()
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Wait()
+	defer server.Process.Kill()
+	run(t, "ip", "link", "add", dhcpClientLink, "type", "veth", "peer", "name", dhcpServerLink)
+	run(t, "ip", "link", "set", dhcpServerLink, "netns", strconv.Itoa(server.Process.Pid))
+	run(t, "ip", "link", "set", dhcpClientLink, "up")
+	messages := make(chan string, 16)
+	go func() {
+		buffer := make([]byte, 256)
+		for {
+			n, err := stdout.Read(buffer)
+			for _, message := range strings.Fields(string(buffer[:n])) {
+				messages <- message
+			}
+			if err != nil {
+				close(messages)
+				return
+			}
+		}
+	}()
+	expectMessage(t, messages, "ready")
+
+	resolvConf := filepath.Join(t.TempDir(), "resolv.conf")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	session, err := startDHCP(ctx, dhcpClientLink, resolvConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, messages, "discover")
+	expectMessage(t, messages, "request")
+	lease := session.dhcpLease()
+	if lease == nil || !lease.IP.IP.Equal(dhcpOfferedIP) || !lease.Router.Equal(dhcpServerAddress.IP) ||
+		lease.LeaseTime != time.Hour {
+		t.Fatalf("unexpected lease %+v", lease)
+	}
+	index := interfaceIndex(t, dhcpClientLink)
+	if !hasAddress(t, index, dhcpOfferedIP) || !hasGatewayRoute(t, index, dhcpServerAddress.IP) {
+		t.Fatal("lease is not applied to interface")
+	}
+	if content, _ := ioutil.ReadFile(resolvConf); !strings.Contains(string(content), "nameserver 198.51.100.53") {
+		t.Errorf("resolv.conf = %q", content)
+	}
+
+	// Renewal is unicast to server through address of lease
+	renewed, err := session.client.Renew(ctx, session.currentLease())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, messages, "renew")
+	if !renewed.IP.Equal(dhcpOfferedIP) {
+		t.Errorf("renewed %v", renewed.IP)
+	}
+
+	session.stop()
+	expectMessage(t, messages, "release")
+	if hasAddress(t, index, dhcpOfferedIP) || hasGatewayRoute(t, index, dhcpServerAddress.IP) {
+		t.Error("lease is not removed from interface")
+	}
+}
+
+// TestDHCPServer is server process of TestDHCPOverVeth, it reports handled messages on stdout.
+func TestDHCPServer(t *testing.T) {
+	if os.Getenv(dhcpTestServer) == "" {
+		t.Skip("server of TestDHCPOverVeth")
+	}
+	var link *net.Interface
+	for deadline := time.Now().Add(time.Second * 10); link == nil; time.Sleep(time.Millisecond * 20) {
+		if time.Now().After(deadline) {
+			t.Fatal("server link did not appear")
+		}
+		link, _ = net.InterfaceByName(dhcpServerLink)
+	}
+	run(t, "ip", "addr", "add", dhcpServerAddress.String(), "dev", dhcpServerLink)
+	run(t, "ip", "link", "set", dhcpServerLink, "up")
+	listenConfig := net.ListenConfig{Control: func(network, address string, rawConn syscall.RawConn) (e error) {
+		rawConn.Control(func(fd uintptr) {
+			if e = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1); e == nil {
+				e = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, dhcpServerLink)
+			}
+		})
+		return
+	}}
+	conn, err := listenConfig.ListenPacket(context.Background(), "udp4", ":67")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("ready")
+	buffer := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request, err := dhcp4.Unmarshal(buffer[:n])
+		if err != nil {
+			continue
+		}
+		reply := &dhcp4.Packet{Op: 2, XID: request.XID, CHAddr: request.CHAddr, YIAddr: dhcpOfferedIP,
+			SIAddr: dhcpServerAddress.IP, Options: map[uint8][]byte{
+				dhcp4.OptionServerID:   dhcpServerAddress.IP.To4(),
+				dhcp4.OptionSubnetMask: net.IP(dhcpServerAddress.Mask).To4(),
+				dhcp4.OptionRouter:     dhcpServerAddress.IP.To4(),
+				dhcp4.OptionDNS:        {198, 51, 100, 53},
+				dhcp4.OptionLeaseTime:  {0, 0, 0x0e, 0x10},
+			}}
+		destination := &net.UDPAddr{IP: net.IPv4bcast, Port: 68}
+		switch request.MessageType() {
+		case dhcp4.MessageDiscover:
+			fmt.Println("discover")
+			reply.Options[dhcp4.OptionMessageType] = []byte{dhcp4.MessageOffer}
+		case dhcp4.MessageRequest:
+			if request.CIAddr.IsUnspecified() {
+				fmt.Println("request")
+			} else {
+				fmt.Println("renew")
+				destination.IP = request.CIAddr
+			}
+			reply.Options[dhcp4.OptionMessageType] = []byte{dhcp4.MessageAck}
+		case dhcp4.MessageRelease:
+			fmt.Println("release")
+			continue
+		default:
+			continue
+		}
+		if _, err := conn.WriteTo(reply.Marshal(), destination); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// runInNetns runs test again in new network namespace, it is skipped when namespace can't be
+// created, e.g. without CAP_NET_ADMIN.
+func runInNetns(t *testing.T, test string, marker string) {
+	if _, err := exec.LookPath("ip"); err != nil {
+		t.Skip("ip command is not available")
+	}
+	if err := exec.Command("unshare", "--net", "true").Run(); err != nil {
+		t.Skip("can't create network namespace", err)
+	}
+	command := exec.Command("unshare", "--net", os.Args[0], "-test.v", "-test.run=^"+test+"$")
+	command.Env = append(os.Environ(), marker+"=1")
+	output, err := command.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s in network namespace failed: %v\n%s", test, err, output)
+	}
+	if strings.Contains(string(output), "--- SKIP") {
+		t.Skipf("%s", output)
+	}
+	t.Logf("%s", output)
+}
+
+func run(t *testing.T, name string, args ...string) {
+	if output, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		t.Fatalf("%s %s: %v %s", name, strings.Join(args, " "), err, output)
+	}
+}
+
+func expectMessage(t *testing.T, messages <-chan string, want string) {
+	select {
+	case message := <-messages:
+		if message != want {
+			t.Fatalf("server got %s, want %s", message, want)
+		}
+	case <-time.After(time.Second * 10):
+		t.Fatalf("server did not get %s", want)
+	}
+}
+
+func interfaceIndex(t *testing.T, name string) int {
+	link, err := net.InterfaceByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return link.Index
+}
+
+func hasAddress(t *testing.T, index int, ip net.IP) bool {
+	addresses, err := netlink.ListAddresses(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, address := range addresses {
+		if address.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasGatewayRoute(t *testing.T, index int, gateway net.IP) bool {
+	routes, err := netlink.ListRoutes(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range routes {
+		if route.IsDefault() && route.Gateway.Equal(gateway) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package wpaconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrScanTimeout           = errors.New("scan_timeout")
+	ErrScanFailed            = errors.New("scan_failed")
+	ErrAssociationTimeout    = errors.New("association_timeout")
+	ErrAuthFailed            = errors.New("auth_failed")
+	ErrConnectionFailed      = errors.New("connection_failed")
+	ErrAssociationRejected   = errors.New("association_rejected")
+	ErrNetworkNotFound       = errors.New("network_not_found")
+	ErrNoAddress             = errors.New("address_not_allocated")
+	ErrProfileNotFound       = errors.New("profile_not_found")
+	ErrNoPreferredNetworks   = errors.New("no_preferred_networks")
+	ErrSaveConfigNotAllowed  = errors.New("save_config_not_allowed")
+	ErrEAPMethodNotSupported = errors.New("eap_method_not_supported")
+	ErrSAENotSupported       = errors.New("sae_not_supported")
+	ErrOWENotSupported       = errors.New("owe_not_supported")
+	ErrModeNotSupported      = errors.New("mode_not_supported")
+	ErrAccessPointNotStarted = errors.New("access_point_not_started")
+	ErrInvalidChannel        = errors.New("invalid_channel")
+	ErrP2PFailed             = errors.New("p2p_failed")
+	ErrP2PTimeout            = errors.New("p2p_timeout")
+	ErrWPSFailed             = errors.New("wps_failed")
+	ErrWPSOverlap            = errors.New("wps_pbc_overlap")
+	ErrWPSTimeout            = errors.New("wps_timeout")
+	ErrWPSRegistrarNotReady  = errors.New("wps_registrar_not_ready")
+)
+
+// DisconnectError is returned when supplicant keeps dropping connection during handshake for
+// reason other than rejected credentials, and is reported by Watch on disconnect. Reason is taken
+// from DisconnectReason property, LocallyGenerated is set when disconnect was initiated by station.
+type DisconnectError struct {
+	Reason           ReasonCode
+	LocallyGenerated bool
+}
+
+func newDisconnectError(disconnectReason int32) *DisconnectError {
+	if disconnectReason < 0 {
+		return &DisconnectError{Reason: ReasonCode(-disconnectReason), LocallyGenerated: true}
+	}
+	return &DisconnectError{Reason: ReasonCode(disconnectReason)}
+}
+
+func (self *DisconnectError) Error() string {
+	return fmt.Sprintf("connection_failed, reason=%d (%s)", self.Reason, self.Reason)
+}
+
+// Is matches ErrConnectionFailed, and ErrAuthFailed for reasons caused by rejected credentials.
+func (self *DisconnectError) Is(target error) bool {
+	return target == ErrConnectionFailed || (target == ErrAuthFailed && self.Reason.IsAuthFailure())
+}
+
+// AuthError is returned when access point rejected credentials, e.g. wrong password.
+// Reason is set for 4-way handshake or EAP failures, Status for rejected authentication.
+type AuthError struct {
+	Reason   ReasonCode
+	Status   StatusCode
+	Attempts int
+}
+
+func (self *AuthError) Error() string {
+	if self.Status != 0 {
+		return fmt.Sprintf("auth_failed, attempts=%d, status=%d (%s)", self.Attempts, self.Status, self.Status)
+	}
+	return fmt.Sprintf("auth_failed, attempts=%d, reason=%d (%s)", self.Attempts, self.Reason, self.Reason)
+}
+
+func (self *AuthError) Is(target error) bool {
+	return target == ErrAuthFailed || target == ErrConnectionFailed
+}
+
+// AssociationRejectedError is returned when access point keeps rejecting association.
+type AssociationRejectedError struct {
+	Status   StatusCode
+	Attempts int
+}
+
+func (self *AssociationRejectedError) Error() string {
+	return fmt.Sprintf("association_rejected, attempts=%d, status=%d (%s)", self.Attempts, self.Status, self.Status)
+}
+
+func (self *AssociationRejectedError) Is(target error) bool {
+	return target == ErrAssociationRejected || target == ErrConnectionFailed
+}
+
+// NotPersistedError is returned by ProfileManager when change is applied to running supplicant,
+// but configuration could not be saved, e.g. with update_config=0. Change is lost on restart.
+type NotPersistedError struct {
+	Err error
+}
+
+func (self *NotPersistedError) Error() string {
+	return "not_persisted, " + self.Err.Error()
+}
+
+func (self *NotPersistedError) Unwrap() error {
+	return self.Err
+}
+
+// WPSError is returned when WPS negotiation failed. ConfigError and ErrorIndication are
+// WPS attribute values reported by supplicant, e.g. config error 15 is setup locked.
+type WPSError struct {
+	Message         int32
+	ConfigError     int32
+	ErrorIndication int32
+}
+
+func (self *WPSError) Error() string {
+	return fmt.Sprintf("wps_failed, msg=%d, config_error=%d, error_indication=%d", self.Message, self.ConfigError, self.ErrorIndication)
+}
+
+func (self *WPSError) Is(target error) bool {
+	return target == ErrWPSFailed
+}
+
+// P2PError is returned when P2P group could not be formed. Stage is go_negotiation,
+// group_formation, provision_discovery or wps, Status is P2P status code of negotiation.
+type P2PError struct {
+	Stage  string
+	Status int32
+	Reason string
+}
+
+func (self *P2PError) Error() string {
+	if self.Reason != "" {
+		return fmt.Sprintf("p2p_failed, stage=%s, reason=%s", self.Stage, self.Reason)
+	}
+	return fmt.Sprintf("p2p_failed, stage=%s, status=%d", self.Stage, self.Status)
+}
+
+func (self *P2PError) Is(target error) bool {
+	return target == ErrP2PFailed
+}
+
+// timeoutError is returned when deadline is exceeded in particular phase of connection.
+// It matches both phase error and context.DeadlineExceeded.
+type timeoutError struct {
+	phase error
+	cause error
+}
+
+func (self *timeoutError) Error() string {
+	return self.phase.Error()
+}
+
+func (self *timeoutError) Is(target error) bool {
+	return target == self.phase
+}
+
+func (self *timeoutError) Unwrap() error {
+	return self.cause
+}
+
+// phaseError converts ctx error to phase timeout. Cancellation is returned as is.
+func phaseError(ctx context.Context, phase error) error {
+	err := ctx.Err()
+	if err == context.DeadlineExceeded {
+		return &timeoutError{phase: phase, cause: err}
+	}
+	return err
+}
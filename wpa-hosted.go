@@ -0,0 +1,220 @@
+package wpaconnect
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/mark2b/wpa-connect/internal/log"
+	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
+)
+
+type Station struct {
+	Address   string
+	Connected time.Time
+}
+
+type StationEventType int
+
+const (
+	StationConnected StationEventType = iota
+	StationDisconnected
+)
+
+func (self StationEventType) String() string {
+	switch self {
+	case StationConnected:
+		return "station_connected"
+	case StationDisconnected:
+		return "station_disconnected"
+	}
+	return "unknown"
+}
+
+type StationEvent struct {
+	Type    StationEventType
+	Station Station
+}
+
+// hostedNetwork is network which interface runs without infrastructure access point, i.e.
+// access point, mesh or IBSS. Stations are tracked from StaAuthorized and StaDeauthorized,
+// mesh peers from MeshPeerConnected and MeshPeerDisconnected signals, until Stop is called.
+type hostedNetwork struct {
+	sync.Mutex
+	NetInterface string
+	wpa          *wpa_dbus.WPA
+	iface        *wpa_dbus.InterfaceWPA
+	network      *wpa_dbus.NetworkWPA
+	networks     []wpa_dbus.NetworkWPA
+	mesh         bool
+	address      *appliedStaticIP
+	stations     map[string]Station
+	events       chan StationEvent
+	started      chan bool
+	stopped      bool
+}
+
+func newHostedNetwork(netInterface string, wpa *wpa_dbus.WPA, iface *wpa_dbus.InterfaceWPA, mesh bool) *hostedNetwork {
+	return &hostedNetwork{NetInterface: netInterface, wpa: wpa.Detached(), iface: iface.Detached(), mesh: mesh,
+		stations: make(map[string]Station), events: make(chan StationEvent, 16), started: make(chan bool, 1)}
+}
+
+// hostedFrequency is frequency of hosted network, frequency takes precedence over channel and
+// default one is used when neither is set.
+func hostedFrequency(frequency int, channel int) (int, error) {
+	switch {
+	case frequency != 0:
+		return frequency, nil
+	case channel == 0:
+		return defaultAccessPointFrequency, nil
+	}
+	if frequency = channelFrequency(channel); frequency == 0 {
+		return 0, ErrInvalidChannel
+	}
+	return frequency, nil
+}
+
+// observe subscribes to signals, it goes before network is added so start is not missed.
+func (self *hostedNetwork) observe(iface *wpa_dbus.InterfaceWPA) error {
+	self.wpa.WaitForSignals(self.onSignal)
+	if iface.AddSignalsObserver(); iface.Error == nil && self.mesh {
+		iface.AddMeshSignalsObserver()
+	}
+	return iface.Error
+}
+
+// start adds network, selects it and waits until supplicant reports completed state. Networks
+// configured before are kept to be enabled again by Stop.
+func (self *hostedNetwork) start(ctx context.Context, iface *wpa_dbus.InterfaceWPA, args map[string]dbus.Variant,
+	address *net.IPNet, phaseTimeout error) (e error) {
+	if self.networks, e = readNetworks(iface); e != nil {
+		return
+	}
+	if iface.AddNetwork(args); iface.Error != nil {
+		if ctx.Err() != nil {
+			ssid, _ := args["ssid"].Value().(string)
+			removeAbandonedNetworks(iface.Detached(), self.networks, ssid)
+		}
+		return iface.Error
+	}
+	self.network = iface.NewNetwork
+	if self.network.Select(); self.network.Error != nil {
+		return self.network.Error
+	}
+	select {
+	case <-self.started:
+	case <-ctx.Done():
+		return phaseError(ctx, phaseTimeout)
+	}
+	if address != nil {
+		config := StaticIPConfig{IP4: address}
+		if address.IP.To4() == nil {
+			config = StaticIPConfig{IP6: address}
+		}
+		self.address, e = config.apply(self.NetInterface)
+	}
+	return
+}
+
+func (self *hostedNetwork) onSignal(wpa *wpa_dbus.WPA, signal *dbus.Signal) {
+	if signal.Path != self.iface.Object.Path() {
+		return
+	}
+	switch signal.Name {
+	case "fi.w1.wpa_supplicant1.Interface.PropertiesChanged":
+		if len(signal.Body) > 0 {
+			properties, _ := signal.Body[0].(map[string]dbus.Variant)
+			if state, ok := properties["State"].Value().(string); ok && state == "completed" {
+				select {
+				case self.started <- true:
+				default:
+				}
+			}
+		}
+	case "fi.w1.wpa_supplicant1.Interface.StaAuthorized":
+		if len(signal.Body) > 0 {
+			if address, ok := signal.Body[0].(string); ok {
+				self.stationChanged(StationEvent{Type: StationConnected, Station: Station{Address: address, Connected: time.Now()}})
+			}
+		}
+	case "fi.w1.wpa_supplicant1.Interface.StaDeauthorized":
+		if len(signal.Body) > 0 {
+			if address, ok := signal.Body[0].(string); ok {
+				self.stationChanged(StationEvent{Type: StationDisconnected, Station: Station{Address: address}})
+			}
+		}
+	case "fi.w1.wpa_supplicant1.Interface.Mesh.MeshPeerConnected":
+		if address, ok := signalArgs(signal, 0)["PeerAddress"].Value().([]byte); ok {
+			self.stationChanged(StationEvent{Type: StationConnected,
+				Station: Station{Address: net.HardwareAddr(address).String(), Connected: time.Now()}})
+		}
+	case "fi.w1.wpa_supplicant1.Interface.Mesh.MeshPeerDisconnected":
+		if address, ok := signalArgs(signal, 0)["PeerAddress"].Value().([]byte); ok {
+			self.stationChanged(StationEvent{Type: StationDisconnected, Station: Station{Address: net.HardwareAddr(address).String()}})
+		}
+	}
+}
+
+// stationChanged updates stations and publishes event, it never blocks D-Bus connection.
+func (self *hostedNetwork) stationChanged(event StationEvent) {
+	self.Lock()
+	defer self.Unlock()
+	if self.stopped {
+		return
+	}
+	if event.Type == StationConnected {
+		self.stations[event.Station.Address] = event.Station
+	} else {
+		if station, ok := self.stations[event.Station.Address]; ok {
+			event.Station = station
+		}
+		delete(self.stations, event.Station.Address)
+	}
+	select {
+	case self.events <- event:
+	default:
+		log.Log.Warning("Station event dropped", event.Type, event.Station.Address)
+	}
+}
+
+// Stations returns stations, or mesh peers, currently associated with network.
+func (self *hostedNetwork) Stations() (stations []Station) {
+	self.Lock()
+	defer self.Unlock()
+	for _, station := range self.stations {
+		stations = append(stations, station)
+	}
+	return
+}
+
+// Events streams station connect and disconnect events, channel is closed by Stop.
+func (self *hostedNetwork) Events() <-chan StationEvent {
+	return self.events
+}
+
+// Stop removes network and enables station networks again.
+func (self *hostedNetwork) Stop() (e error) {
+	self.Lock()
+	if self.stopped {
+		self.Unlock()
+		return
+	}
+	self.stopped = true
+	close(self.events)
+	self.Unlock()
+	if self.address != nil {
+		self.address.remove()
+		self.address = nil
+	}
+	if self.mesh {
+		self.iface.RemoveMeshSignalsObserver()
+	}
+	e = self.iface.RemoveSignalsObserver().Error
+	self.wpa.StopWaitForSignals()
+	if self.network != nil {
+		restoreNetworks(self.iface, self.networks, self.network, "", false)
+	}
+	return
+}
@@ -0,0 +1,39 @@
+package wpaconnect
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHostedFrequency(t *testing.T) {
+	tests := []struct {
+		frequency, channel int
+		want               int
+		wantError          error
+	}{
+		{0, 0, defaultAccessPointFrequency, nil},
+		{5180, 0, 5180, nil},
+		{2412, 11, 2412, nil},
+		{0, 1, 2412, nil},
+		{0, 14, 2484, nil},
+		{0, 36, 5180, nil},
+		{0, 15, 0, ErrInvalidChannel},
+		{0, 200, 0, ErrInvalidChannel},
+		{0, 38, 0, ErrInvalidChannel},
+		{0, -1, 0, ErrInvalidChannel},
+	}
+	for _, test := range tests {
+		if got, err := hostedFrequency(test.frequency, test.channel); got != test.want || err != test.wantError {
+			t.Errorf("hostedFrequency(%d, %d) = %d, %v, want %d, %v", test.frequency, test.channel, got, err,
+				test.want, test.wantError)
+		}
+	}
+	// Invalid channel fails before supplicant is reached
+	manager := NewConnectManager("wlan0")
+	if _, err := manager.StartAccessPoint(context.Background(), AccessPointConfig{SSID: "setup", Channel: 15}); err != ErrInvalidChannel {
+		t.Errorf("StartAccessPoint: got %v, want ErrInvalidChannel", err)
+	}
+	if _, err := manager.JoinAdHoc(context.Background(), AdHocConfig{SSID: "mesh", Channel: 180}); err != ErrInvalidChannel {
+		t.Errorf("JoinAdHoc: got %v, want ErrInvalidChannel", err)
+	}
+}
@@ -0,0 +1,232 @@
+package wpaconnect
+
+import "fmt"
+
+// ReasonCode is IEEE 802.11 reason code sent in Deauthentication and Disassociation frames.
+type ReasonCode uint16
+
+// StatusCode is IEEE 802.11 status code sent in Authentication and Association Response frames.
+type StatusCode uint16
+
+func (self ReasonCode) String() string {
+	if name, ok := reasonCodeNames[self]; ok {
+		return name
+	}
+	return fmt.Sprintf("reason %d", uint16(self))
+}
+
+// IsAuthFailure reports whether reason is typical for wrong password or rejected credentials.
+func (self ReasonCode) IsAuthFailure() bool {
+	switch self {
+	case 2, 15, 16, 17, 23, 49:
+		return true
+	}
+	return false
+}
+
+func (self StatusCode) String() string {
+	if name, ok := statusCodeNames[self]; ok {
+		return name
+	}
+	return fmt.Sprintf("status %d", uint16(self))
+}
+
+// IsAuthFailure reports whether status is typical for wrong password or rejected credentials.
+func (self StatusCode) IsAuthFailure() bool {
+	switch self {
+	case 15, 53, 112, 123:
+		return true
+	}
+	return false
+}
+
+var reasonCodeNames = map[ReasonCode]string{
+	1:  "unspecified",
+	2:  "previous authentication no longer valid",
+	3:  "deauthenticated because sending station is leaving",
+	4:  "disassociated due to inactivity",
+	5:  "disassociated because AP is unable to handle all associated stations",
+	6:  "class 2 frame received from nonauthenticated station",
+	7:  "class 3 frame received from nonassociated station",
+	8:  "disassociated because sending station is leaving BSS",
+	9:  "station requesting (re)association is not authenticated",
+	10: "power capability element is unacceptable",
+	11: "supported channels element is unacceptable",
+	12: "disassociated due to BSS transition management",
+	13: "invalid element",
+	14: "message integrity code (MIC) failure",
+	15: "4-way handshake timeout",
+	16: "group key handshake timeout",
+	17: "element in 4-way handshake different from (re)association request",
+	18: "invalid group cipher",
+	19: "invalid pairwise cipher",
+	20: "invalid AKMP",
+	21: "unsupported RSNE version",
+	22: "invalid RSNE capabilities",
+	23: "IEEE 802.1X authentication failed",
+	24: "cipher suite rejected because of security policy",
+	25: "TDLS direct-link teardown due to TDLS peer unreachable",
+	26: "TDLS direct-link teardown for unspecified reason",
+	27: "disassociated because session terminated by SSP request",
+	28: "disassociated because of lack of SSP roaming agreement",
+	29: "requested service rejected because of SSP cipher suite or AKM requirement",
+	30: "requested service not authorized in this location",
+	31: "TS deleted because QoS AP lacks sufficient bandwidth",
+	32: "disassociated for unspecified QoS-related reason",
+	33: "disassociated because QoS AP lacks sufficient bandwidth",
+	34: "disassociated because of excessive unacknowledged frames",
+	35: "disassociated because station is transmitting outside TXOP limits",
+	36: "requesting station is leaving BSS or resetting",
+	37: "requesting station is no longer using stream or session",
+	38: "requesting station received frames using unset up mechanism",
+	39: "requested from peer station due to timeout",
+	45: "peer station does not support requested cipher suite",
+	46: "disassociated because authorized access limit reached",
+	47: "disassociated due to external service requirements",
+	48: "invalid FT action frame count",
+	49: "invalid PMKID",
+	50: "invalid MDE",
+	51: "invalid FTE",
+	52: "mesh peering cancelled",
+	53: "mesh maximum number of peers reached",
+	54: "mesh configuration policy violation",
+	55: "mesh close frame received",
+	56: "mesh maximum number of retries reached",
+	57: "mesh confirm timeout",
+	58: "mesh invalid GTK",
+	59: "mesh inconsistent parameters",
+	60: "mesh invalid security capability",
+	61: "mesh path error: no proxy information",
+	62: "mesh path error: no forwarding information",
+	63: "mesh path error: destination unreachable",
+	64: "MAC address already exists in MBSS",
+	65: "mesh channel switch due to regulatory requirements",
+	66: "mesh channel switch for unspecified reason",
+	67: "transmission link establishment failed",
+	68: "alternative channel occupied",
+	71: "poor RSSI conditions",
+}
+
+var statusCodeNames = map[StatusCode]string{
+	0:   "success",
+	1:   "unspecified failure",
+	2:   "TDLS wakeup schedule rejected, alternative provided",
+	3:   "TDLS wakeup schedule rejected",
+	5:   "security disabled",
+	6:   "unacceptable lifetime",
+	7:   "not in same BSS",
+	10:  "cannot support all requested capabilities",
+	11:  "reassociation denied, association cannot be confirmed",
+	12:  "association denied for reason outside scope of standard",
+	13:  "authentication algorithm not supported",
+	14:  "authentication transaction sequence number out of expected sequence",
+	15:  "authentication rejected because of challenge failure",
+	16:  "authentication rejected due to timeout",
+	17:  "AP is unable to handle additional associated stations",
+	18:  "association denied, basic rates not supported",
+	19:  "association denied, short preamble not supported",
+	22:  "association denied, spectrum management required",
+	23:  "association denied, power capability element unacceptable",
+	24:  "association denied, supported channels element unacceptable",
+	25:  "association denied, short slot time not supported",
+	27:  "association denied, HT not supported",
+	28:  "R0KH unreachable",
+	29:  "association denied, PCO transition time not supported",
+	30:  "association rejected temporarily, try again later",
+	31:  "robust management frame policy violation",
+	32:  "unspecified QoS-related failure",
+	33:  "association denied, insufficient bandwidth",
+	34:  "association denied, poor channel conditions",
+	35:  "association denied, QoS not supported",
+	37:  "request declined",
+	38:  "invalid parameters",
+	39:  "rejected with suggested changes",
+	40:  "invalid element",
+	41:  "invalid group cipher",
+	42:  "invalid pairwise cipher",
+	43:  "invalid AKMP",
+	44:  "unsupported RSNE version",
+	45:  "invalid RSNE capabilities",
+	46:  "cipher suite rejected because of security policy",
+	47:  "TS not created",
+	48:  "direct link not allowed in BSS",
+	49:  "destination station not present in BSS",
+	50:  "destination station is not QoS station",
+	51:  "association denied, listen interval too large",
+	52:  "invalid FT action frame count",
+	53:  "invalid PMKID",
+	54:  "invalid MDE",
+	55:  "invalid FTE",
+	56:  "requested TCLAS not supported",
+	57:  "insufficient TCLAS processing resources",
+	58:  "try another BSS",
+	59:  "GAS advertisement protocol not supported",
+	60:  "no outstanding GAS request",
+	61:  "GAS response not received from advertisement server",
+	62:  "timeout waiting for GAS query response",
+	63:  "GAS response larger than query response length limit",
+	64:  "request refused by home network",
+	65:  "advertisement server unreachable",
+	67:  "request refused due to SSPN permissions",
+	68:  "request refused, unauthenticated access not supported",
+	72:  "invalid RSNE contents",
+	73:  "U-APSD coexistence not supported",
+	74:  "requested U-APSD coexistence mode not supported",
+	75:  "requested interval or duration not supported with U-APSD coexistence",
+	76:  "anti-clogging token required",
+	77:  "finite cyclic group not supported",
+	78:  "cannot find alternative TBTT",
+	79:  "transmission failure",
+	80:  "requested TCLAS not supported",
+	81:  "TCLAS resources exhausted",
+	82:  "rejected with suggested BSS transition",
+	83:  "reject with recommended schedule",
+	84:  "reject, no wakeup specified",
+	85:  "success, destination in power save mode",
+	86:  "FST pending, admitting FST session",
+	87:  "performing FST now",
+	88:  "FST pending, gap in block ack window",
+	89:  "reject because of U-PID setting",
+	92:  "refused because of external reason",
+	93:  "refused because AP is out of memory",
+	94:  "rejected, emergency services not supported",
+	95:  "GAS query response outstanding",
+	96:  "reject, DSE band",
+	97:  "TCLAS processing terminated",
+	98:  "TS schedule conflict",
+	99:  "denied with suggested band and channel",
+	100: "MCCAOP reservation conflict",
+	101: "MAF limit exceeded",
+	102: "MCCA track limit exceeded",
+	103: "denied due to spectrum management",
+	104: "association denied, VHT not supported",
+	105: "enablement denied",
+	106: "restriction from authorized GDB",
+	107: "authorization deenabled",
+	108: "energy limited operation not supported",
+	109: "rejected, NDP block ack suggested",
+	110: "rejected, maximum away duration unacceptable",
+	111: "flow control operation supported",
+	112: "FILS authentication failure",
+	113: "unknown authentication server",
+	116: "denied, notification period allocation",
+	117: "denied, channel splitting",
+	118: "denied, allocation",
+	119: "CMMG features not supported",
+	120: "GAS fragment not available",
+	121: "success, CAG versions match",
+	122: "GLK not authorized",
+	123: "unknown password identifier",
+	125: "denied, local MAC address policy violation",
+	126: "SAE hash-to-element",
+	128: "TCLAS processing terminated, insufficient QoS",
+	129: "TCLAS processing terminated, policy conflict",
+	130: "association denied, HE not supported",
+	131: "SAE public key",
+	133: "denied, station affiliated with MLD with existing MLD association",
+	134: "EPCS denied, unauthorized",
+	135: "EPCS denied",
+	136: "denied, TID-to-link mapping",
+	137: "preferred TID-to-link mapping suggested",
+	138: "association denied, EHT not supported",
+}
@@ -0,0 +1,249 @@
+package wpaconnect
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Element IDs of IEEE 802.11 information elements, extension element IDs follow element 255.
+const (
+	ieCountry              = 7
+	ieBSSLoad              = 11
+	ieHTCapabilities       = 45
+	ieMobilityDomain       = 54
+	ieHTOperation          = 61
+	ieRMCapabilities       = 70
+	ieMeshID               = 114
+	ieExtendedCapabilities = 127
+	ieVHTCapabilities      = 191
+	ieVHTOperation         = 192
+	ieVendorSpecific       = 221
+	ieExtension            = 255
+
+	ieExtHECapabilities  = 35
+	ieExtHEOperation     = 36
+	ieExtEHTOperation    = 106
+	ieExtEHTCapabilities = 108
+)
+
+// InformationElements are common elements of beacon or probe response. ChannelWidth in MHz is
+// operating width taken from HT, VHT, HE and EHT operation elements, 20 when there are none.
+type InformationElements struct {
+	Country              string
+	HT                   *HTCapabilities
+	VHT                  *VHTCapabilities
+	HE                   bool
+	EHT                  bool
+	ChannelWidth         int
+	BSSLoad              *BSSLoad
+	MobilityDomain       *MobilityDomain
+	RMCapabilities       *RMCapabilities
+	ExtendedCapabilities *ExtendedCapabilities
+	VendorOUIs           []string
+	MeshID               string
+}
+
+// HTCapabilities is 802.11n capability of BSS.
+type HTCapabilities struct {
+	Width40        bool
+	ShortGI20      bool
+	ShortGI40      bool
+	SpatialStreams int
+}
+
+// VHTCapabilities is 802.11ac capability of BSS.
+type VHTCapabilities struct {
+	Width160       bool
+	ShortGI80      bool
+	ShortGI160     bool
+	SpatialStreams int
+}
+
+// BSSLoad is load advertised by access point. ChannelUtilization is share of time medium was
+// sensed busy, scaled to 255.
+type BSSLoad struct {
+	StationCount       int
+	ChannelUtilization int
+}
+
+// MobilityDomain advertises 802.11r fast transition.
+type MobilityDomain struct {
+	ID        uint16
+	FTOverDS  bool
+	FTRequest bool
+}
+
+// RMCapabilities are 802.11k radio measurements access point supports.
+type RMCapabilities struct {
+	LinkMeasurement bool
+	NeighborReport  bool
+	BeaconPassive   bool
+	BeaconActive    bool
+	BeaconTable     bool
+}
+
+// ExtendedCapabilities are capabilities of Extended Capabilities element, BSSTransition and
+// WNMSleepMode are 802.11v, Interworking is 802.11u.
+type ExtendedCapabilities struct {
+	ProxyARP      bool
+	WNMSleepMode  bool
+	BSSTransition bool
+	Interworking  bool
+	FTMResponder  bool
+}
+
+// UtilizationPercent is ChannelUtilization in percents.
+func (self *BSSLoad) UtilizationPercent() int {
+	return self.ChannelUtilization * 100 / 255
+}
+
+// parseInformationElements decodes elements, malformed element ends parsing with elements
+// decoded so far.
+func parseInformationElements(ies []byte) (elements InformationElements) {
+	elements.ChannelWidth = 20
+	for i := 0; i+2 <= len(ies); {
+		id, length := ies[i], int(ies[i+1])
+		if i+2+length > len(ies) {
+			break
+		}
+		data := ies[i+2 : i+2+length]
+		i += 2 + length
+		switch id {
+		case ieCountry:
+			if len(data) >= 2 {
+				elements.Country = string(data[:2])
+			}
+		case ieBSSLoad:
+			if len(data) >= 3 {
+				elements.BSSLoad = &BSSLoad{StationCount: int(binary.LittleEndian.Uint16(data)), ChannelUtilization: int(data[2])}
+			}
+		case ieHTCapabilities:
+			if len(data) >= 7 {
+				info := binary.LittleEndian.Uint16(data)
+				elements.HT = &HTCapabilities{Width40: info&0x02 != 0, ShortGI20: info&0x20 != 0, ShortGI40: info&0x40 != 0}
+				for _, mcs := range data[3:7] {
+					if mcs != 0 {
+						elements.HT.SpatialStreams++
+					}
+				}
+			}
+		case ieHTOperation:
+			if len(data) >= 2 && data[1]&0x03 != 0 && data[1]&0x04 != 0 {
+				elements.widen(40)
+			}
+		case ieMobilityDomain:
+			if len(data) >= 3 {
+				elements.MobilityDomain = &MobilityDomain{ID: binary.LittleEndian.Uint16(data),
+					FTOverDS: data[2]&0x01 != 0, FTRequest: data[2]&0x02 != 0}
+			}
+		case ieRMCapabilities:
+			if len(data) >= 1 {
+				elements.RMCapabilities = &RMCapabilities{LinkMeasurement: data[0]&0x01 != 0, NeighborReport: data[0]&0x02 != 0,
+					BeaconPassive: data[0]&0x10 != 0, BeaconActive: data[0]&0x20 != 0, BeaconTable: data[0]&0x40 != 0}
+			}
+		case ieMeshID:
+			elements.MeshID = string(data)
+		case ieExtendedCapabilities:
+			elements.ExtendedCapabilities = &ExtendedCapabilities{ProxyARP: bit(data, 12), WNMSleepMode: bit(data, 17),
+				BSSTransition: bit(data, 19), Interworking: bit(data, 31), FTMResponder: bit(data, 70)}
+		case ieVHTCapabilities:
+			if len(data) >= 6 {
+				info := binary.LittleEndian.Uint32(data)
+				elements.VHT = &VHTCapabilities{Width160: info&0x0c != 0, ShortGI80: info&0x20 != 0, ShortGI160: info&0x40 != 0}
+				mcsMap := binary.LittleEndian.Uint16(data[4:])
+				for stream := uint(0); stream < 8; stream++ {
+					if (mcsMap>>(stream*2))&0x03 != 0x03 {
+						elements.VHT.SpatialStreams++
+					}
+				}
+			}
+		case ieVHTOperation:
+			if len(data) >= 3 {
+				elements.widen(vhtChannelWidth(data[0], data[1], data[2]))
+			}
+		case ieVendorSpecific:
+			if len(data) >= 3 {
+				elements.addVendorOUI(fmt.Sprintf("%02x:%02x:%02x", data[0], data[1], data[2]))
+			}
+		case ieExtension:
+			if len(data) >= 1 {
+				elements.parseExtension(data[0], data[1:])
+			}
+		}
+	}
+	return
+}
+
+func (self *InformationElements) parseExtension(id byte, data []byte) {
+	switch id {
+	case ieExtHECapabilities:
+		self.HE = true
+	case ieExtHEOperation:
+		// HE Operation Parameters (3), BSS Color (1), Basic HE-MCS (2), then optional VHT Operation
+		// Information (3), Max Co-Hosted BSSID Indicator (1) and 6 GHz Operation Information (5).
+		if len(data) < 6 {
+			return
+		}
+		parameters := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+		offset := 6
+		if parameters&(1<<14) != 0 {
+			if len(data) >= offset+3 {
+				self.widen(vhtChannelWidth(data[offset], data[offset+1], data[offset+2]))
+			}
+			offset += 3
+		}
+		if parameters&(1<<15) != 0 {
+			offset++
+		}
+		if parameters&(1<<17) != 0 && len(data) >= offset+5 {
+			self.widen([]int{20, 40, 80, 160}[data[offset+1]&0x03])
+		}
+	case ieExtEHTCapabilities:
+		self.EHT = true
+	case ieExtEHTOperation:
+		// EHT Operation Parameters (1), Basic EHT-MCS (4), then EHT Operation Information when
+		// parameters say so, its Control field (1) carries width.
+		if len(data) >= 6 && data[0]&0x01 != 0 {
+			if width := data[5] & 0x07; width <= 4 {
+				self.widen([]int{20, 40, 80, 160, 320}[width])
+			}
+		}
+	}
+}
+
+func (self *InformationElements) widen(width int) {
+	if width > self.ChannelWidth {
+		self.ChannelWidth = width
+	}
+}
+
+func (self *InformationElements) addVendorOUI(oui string) {
+	if !containsString(self.VendorOUIs, oui) {
+		self.VendorOUIs = append(self.VendorOUIs, oui)
+	}
+}
+
+// vhtChannelWidth decodes Channel Width and Channel Center Frequency Segment fields of VHT
+// Operation Information. 160 MHz is signalled by segment 1 8 channels apart from segment 0,
+// 80+80 MHz, reported as 160, by segments more than 16 channels apart.
+func vhtChannelWidth(width byte, segment0 byte, segment1 byte) int {
+	switch width {
+	case 0:
+		return 20
+	case 1:
+		if segment1 != 0 {
+			if diff := int(segment1) - int(segment0); diff == 8 || diff == -8 || diff > 16 || diff < -16 {
+				return 160
+			}
+		}
+		return 80
+	case 2, 3:
+		return 160
+	}
+	return 20
+}
+
+// bit reports whether bit of little endian bit field is set, bits beyond data are unset.
+func bit(data []byte, index int) bool {
+	return index/8 < len(data) && data[index/8]&(1<<uint(index%8)) != 0
+}
@@ -0,0 +1,181 @@
+package wpaconnect
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// beaconIEs are elements of beacon captured from 5 GHz access point: SSID "home", rates, DS,
+// Country DE, BSS Load, HT, HT Operation, MDE, RM capabilities, Extended Capabilities, VHT,
+// VHT Operation at 160 MHz, HE capabilities and vendor elements of WMM, Qualcomm and WPS.
+const beaconIEs = "0004686f6d65010882848b960c12182403012407064445200124140b0503002a00002d1aef0117ffff00000000000000" +
+	"00000000000000000000000000003d16240504000000000000000000000000000000000000003603a1b2014605730000" +
+	"00007f080400080000000040bf0cb279c33faaff0000aaff0020c005012a32fcffff17230108081a00100c0f00000000" +
+	"000000000000fafffaffff072404400000fcffdd180050f2020101800003a4000027a4000042435e0062322f00dd0700" +
+	"037f01010000dd050050f20401"
+
+func TestParseInformationElements(t *testing.T) {
+	tests := []struct {
+		name string
+		ies  string
+		want InformationElements
+	}{
+		{
+			name: "beacon",
+			ies:  beaconIEs,
+			want: InformationElements{
+				Country:              "DE",
+				HT:                   &HTCapabilities{Width40: true, ShortGI20: true, ShortGI40: true, SpatialStreams: 2},
+				VHT:                  &VHTCapabilities{ShortGI80: true, SpatialStreams: 4},
+				HE:                   true,
+				ChannelWidth:         160,
+				BSSLoad:              &BSSLoad{StationCount: 3, ChannelUtilization: 42},
+				MobilityDomain:       &MobilityDomain{ID: 45729, FTOverDS: true},
+				RMCapabilities:       &RMCapabilities{true, true, true, true, true},
+				ExtendedCapabilities: &ExtendedCapabilities{BSSTransition: true},
+				VendorOUIs:           []string{"00:50:f2", "00:03:7f"},
+			},
+		},
+		{
+			name: "no elements",
+			want: InformationElements{ChannelWidth: 20},
+		},
+		{
+			name: "HT 20 MHz",
+			ies:  "2d1a0c0103ff" + strings.Repeat("00", 22) + "3d1606" + strings.Repeat("00", 21),
+			want: InformationElements{HT: &HTCapabilities{SpatialStreams: 1}, ChannelWidth: 20},
+		},
+		{
+			name: "HT 40 MHz",
+			ies:  "3d162605" + strings.Repeat("00", 20),
+			want: InformationElements{ChannelWidth: 40},
+		},
+		{
+			name: "VHT 80 MHz",
+			ies:  "bf0ca2018003faff0000faff0000" + "c005012a00fcff",
+			want: InformationElements{VHT: &VHTCapabilities{ShortGI80: true, SpatialStreams: 2}, ChannelWidth: 80},
+		},
+		{
+			name: "VHT 160 MHz capable",
+			ies:  "bf0c7a018003feff0000feff0000" + "c005023200fcff",
+			want: InformationElements{VHT: &VHTCapabilities{Width160: true, ShortGI80: true, ShortGI160: true,
+				SpatialStreams: 1}, ChannelWidth: 160},
+		},
+		{
+			name: "VHT 80+80 MHz",
+			ies:  "c005012a9bfcff",
+			want: InformationElements{ChannelWidth: 160},
+		},
+		{
+			name: "HE operation with VHT information",
+			ies:  "ff022300" + "ff0a24004000" + "01fcff" + "012a00",
+			want: InformationElements{HE: true, ChannelWidth: 80},
+		},
+		{
+			name: "HE 6 GHz operation",
+			ies:  "ff022300" + "ff0c24000002" + "01fcff" + "25031f2f01",
+			want: InformationElements{HE: true, ChannelWidth: 160},
+		},
+		{
+			name: "EHT 320 MHz",
+			ies:  "ff026c00" + "ff096a0100000000041f2f",
+			want: InformationElements{EHT: true, ChannelWidth: 320},
+		},
+		{
+			name: "EHT operation without information",
+			ies:  "ff026c00" + "ff066a0000000000",
+			want: InformationElements{EHT: true, ChannelWidth: 20},
+		},
+		{
+			name: "narrower operation does not shrink width",
+			ies:  "c005012a32fcff" + "3d162605" + strings.Repeat("00", 20),
+			want: InformationElements{ChannelWidth: 160},
+		},
+		{
+			name: "extended capabilities",
+			ies:  "7f0900100a800000000040",
+			want: InformationElements{ChannelWidth: 20, ExtendedCapabilities: &ExtendedCapabilities{ProxyARP: true,
+				WNMSleepMode: true, BSSTransition: true, Interworking: true, FTMResponder: true}},
+		},
+		{
+			name: "short extended capabilities",
+			ies:  "7f0104",
+			want: InformationElements{ChannelWidth: 20, ExtendedCapabilities: &ExtendedCapabilities{}},
+		},
+		{
+			name: "vendor OUIs are listed once",
+			ies:  "dd070050f202010100" + "dd0900101802000c000000" + "dd050050f20401",
+			want: InformationElements{ChannelWidth: 20, VendorOUIs: []string{"00:50:f2", "00:10:18"}},
+		},
+		{
+			name: "mesh ID",
+			ies:  "0000" + "72046d657368" + "710701010001000100",
+			want: InformationElements{ChannelWidth: 20, MeshID: "mesh"},
+		},
+		{
+			name: "too short elements are ignored",
+			ies: "0701" + "44" + "0b020300" + "2d02ef01" + "3601a1" + "4600" + "bf020000" + "c0020100" + "dd020050" +
+				"ff00" + "ff0124" + "ff066a0100000000" + "ff0724000002010000" + "ff09240040000100000100",
+			want: InformationElements{ChannelWidth: 20},
+		},
+		{
+			name: "truncated element ends parsing",
+			ies:  "0706444520012414" + "2d1aef01",
+			want: InformationElements{Country: "DE", ChannelWidth: 20},
+		},
+		{
+			name: "over-long element ends parsing",
+			ies:  "0b0503002a0000" + "ddff0050f2" + "72046d657368",
+			want: InformationElements{ChannelWidth: 20, BSSLoad: &BSSLoad{StationCount: 3, ChannelUtilization: 42}},
+		},
+		{
+			name: "header without length",
+			ies:  "72046d657368" + "07",
+			want: InformationElements{ChannelWidth: 20, MeshID: "mesh"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ies, err := hex.DecodeString(test.ies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := parseInformationElements(ies); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %s, want %s", describeElements(got), describeElements(test.want))
+			}
+		})
+	}
+}
+
+func TestParseInformationElementsTruncated(t *testing.T) {
+	ies, _ := hex.DecodeString(beaconIEs)
+	for length := range ies {
+		parseInformationElements(ies[:length])
+	}
+	// each element of beacon declaring up to 255 bytes more than it has
+	for i := 0; i+1 < len(ies); i += 2 + int(ies[i+1]) {
+		for _, extra := range []int{1, 255 - int(ies[i+1])} {
+			corrupted := append([]byte(nil), ies...)
+			corrupted[i+1] += byte(extra)
+			parseInformationElements(corrupted)
+		}
+	}
+}
+
+func TestBSSLoadUtilizationPercent(t *testing.T) {
+	for utilization, want := range map[int]int{0: 0, 42: 16, 128: 50, 255: 100} {
+		load := &BSSLoad{ChannelUtilization: utilization}
+		if got := load.UtilizationPercent(); got != want {
+			t.Errorf("UtilizationPercent of %d = %d, want %d", utilization, got, want)
+		}
+	}
+}
+
+// describeElements shows elements behind pointers too.
+func describeElements(elements InformationElements) string {
+	description, _ := json.Marshal(elements)
+	return string(description)
+}
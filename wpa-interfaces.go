@@ -0,0 +1,286 @@
+package wpaconnect
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus"
+	"github.com/mark2b/wpa-connect/internal/log"
+	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
+)
+
+const (
+	sysClassNet            = "/sys/class/net"
+	defaultNetInterface    = "wlan0"
+	defaultInterfaceDriver = "nl80211"
+)
+
+// Interface is network interface managed by supplicant.
+type Interface struct {
+	Name       string
+	Driver     string
+	BridgeName string
+	State      string
+	path       dbus.ObjectPath
+}
+
+// InterfaceConfig describes interface to be managed by supplicant. Driver is nl80211 when
+// empty, ConfigFile is supplicant configuration file networks are loaded from and saved to.
+type InterfaceConfig struct {
+	Name       string
+	Driver     string
+	ConfigFile string
+	BridgeName string
+}
+
+type InterfaceEventType int
+
+const (
+	InterfaceAdded InterfaceEventType = iota
+	InterfaceRemoved
+)
+
+func (self InterfaceEventType) String() string {
+	switch self {
+	case InterfaceAdded:
+		return "interface_added"
+	case InterfaceRemoved:
+		return "interface_removed"
+	}
+	return "unknown"
+}
+
+type InterfaceEvent struct {
+	Type      InterfaceEventType
+	Interface Interface
+}
+
+// Interfaces lists interfaces managed by supplicant.
+func (self *interfaceManager) Interfaces(ctx context.Context) (interfaces []Interface, e error) {
+	if wpa, err := wpa_dbus.NewWPAWithContext(ctx); err == nil {
+		if wpa.ReadInterfaceList(); wpa.Error == nil {
+			for _, iface := range wpa.Interfaces {
+				if iface.ReadIfname().ReadDriver().ReadBridgeIfname().ReadState(); iface.Error == nil {
+					interfaces = append(interfaces, newInterface(&iface))
+				} else {
+					e = iface.Error
+					break
+				}
+			}
+		} else {
+			e = wpa.Error
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+// Create makes supplicant manage interface, it fails when interface is managed already. Empty
+// Name stands for DefaultInterface.
+func (self *interfaceManager) Create(ctx context.Context, config InterfaceConfig) (iface Interface, e error) {
+	config.Name = netInterfaceOrDefault(config.Name)
+	if wpa, err := wpa_dbus.NewWPAWithContext(ctx); err == nil {
+		if wpa.CreateInterface(config.args()); wpa.Error == nil {
+			if wpa.Interface.ReadIfname().ReadDriver().ReadBridgeIfname().ReadState(); wpa.Interface.Error == nil {
+				iface = newInterface(wpa.Interface)
+			} else {
+				e = wpa.Interface.Error
+			}
+		} else {
+			e = wpa.Error
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+// Ensure returns interface managed by supplicant, it is created when supplicant does not manage
+// it yet. Any other failure to look interface up is returned as is.
+func (self *interfaceManager) Ensure(ctx context.Context, config InterfaceConfig) (iface Interface, e error) {
+	config.Name = netInterfaceOrDefault(config.Name)
+	if wpa, err := wpa_dbus.NewWPAWithContext(ctx); err == nil {
+		if wpa.ReadInterface(config.Name); wpa.Error == nil {
+			if wpa.Interface.ReadIfname().ReadDriver().ReadBridgeIfname().ReadState(); wpa.Interface.Error == nil {
+				iface = newInterface(wpa.Interface)
+			} else {
+				e = wpa.Interface.Error
+			}
+		} else if isInterfaceUnknown(wpa.Error) {
+			log.Log.Debug("Interface is not managed, creating", config.Name)
+			iface, e = self.Create(ctx, config)
+		} else {
+			e = wpa.Error
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+// Remove makes supplicant stop managing interface, network interface itself is left in place.
+func (self *interfaceManager) Remove(ctx context.Context, name string) (e error) {
+	if wpa, err := wpa_dbus.NewWPAWithContext(ctx); err == nil {
+		if wpa.ReadInterface(name); wpa.Error == nil {
+			e = wpa.RemoveInterface(wpa.Interface.Object.Path()).Error
+		} else {
+			e = wpa.Error
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+// Watch streams interface added and removed events until ctx is done, channel is closed then.
+func (self *interfaceManager) Watch(ctx context.Context) (events <-chan InterfaceEvent, e error) {
+	if wpa, err := wpa_dbus.NewWPAWithContext(ctx); err == nil {
+		watcher := &interfaceWatcher{wpa: wpa, names: make(map[dbus.ObjectPath]Interface),
+			signals: make(chan *dbus.Signal, 16), events: make(chan InterfaceEvent, 16)}
+		wpa.WaitForSignals(watcher.onSignal)
+		if wpa.AddSignalsObserver(); wpa.Error == nil {
+			if interfaces, err := self.Interfaces(ctx); err == nil {
+				for _, iface := range interfaces {
+					watcher.names[iface.path] = iface
+				}
+			}
+			go watcher.run(ctx)
+			events = watcher.events
+		} else {
+			e = wpa.Error
+			wpa.StopWaitForSignals()
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+type interfaceWatcher struct {
+	wpa     *wpa_dbus.WPA
+	names   map[dbus.ObjectPath]Interface
+	signals chan *dbus.Signal
+	events  chan InterfaceEvent
+}
+
+// onSignal forwards interface added and removed signals.
+func (self *interfaceWatcher) onSignal(wpa *wpa_dbus.WPA, signal *dbus.Signal) {
+	if signal.Name == "fi.w1.wpa_supplicant1.InterfaceAdded" || signal.Name == "fi.w1.wpa_supplicant1.InterfaceRemoved" {
+		forwardSignal(self.signals, signal, "Interface watch")
+	}
+}
+
+func (self *interfaceWatcher) run(ctx context.Context) {
+	defer func() {
+		self.wpa.RemoveSignalsObserver()
+		self.wpa.StopWaitForSignals()
+		close(self.events)
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case signal := <-self.signals:
+			path := signalPath(signal, 0)
+			event := InterfaceEvent{Type: InterfaceRemoved, Interface: self.names[path]}
+			if signal.Name == "fi.w1.wpa_supplicant1.InterfaceAdded" {
+				properties := signalArgs(signal, 1)
+				event = InterfaceEvent{Type: InterfaceAdded, Interface: Interface{path: path}}
+				event.Interface.Name, _ = properties["Ifname"].Value().(string)
+				event.Interface.Driver, _ = properties["Driver"].Value().(string)
+				event.Interface.BridgeName, _ = properties["BridgeIfname"].Value().(string)
+				event.Interface.State, _ = properties["State"].Value().(string)
+				self.names[path] = event.Interface
+			} else {
+				delete(self.names, path)
+			}
+			select {
+			case self.events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (self *InterfaceConfig) args() map[string]dbus.Variant {
+	args := map[string]dbus.Variant{"Ifname": dbus.MakeVariant(self.Name), "Driver": dbus.MakeVariant(defaultInterfaceDriver)}
+	if self.Driver != "" {
+		args["Driver"] = dbus.MakeVariant(self.Driver)
+	}
+	if self.ConfigFile != "" {
+		args["ConfigFile"] = dbus.MakeVariant(self.ConfigFile)
+	}
+	if self.BridgeName != "" {
+		args["BridgeIfname"] = dbus.MakeVariant(self.BridgeName)
+	}
+	return args
+}
+
+// isInterfaceUnknown reports whether GetInterface failed because supplicant does not manage interface.
+func isInterfaceUnknown(e error) bool {
+	dbusError, ok := e.(dbus.Error)
+	return ok && dbusError.Name == "fi.w1.wpa_supplicant1.InterfaceUnknown"
+}
+
+func newInterface(iface *wpa_dbus.InterfaceWPA) Interface {
+	return Interface{Name: iface.Ifname, Driver: iface.Driver, BridgeName: iface.BridgeIfname, State: iface.State,
+		path: iface.Object.Path()}
+}
+
+// WirelessInterfaces lists wireless network interfaces found in /sys/class/net, whether
+// supplicant manages them or not.
+func WirelessInterfaces() (names []string, e error) {
+	var entries []os.FileInfo
+	if entries, e = ioutil.ReadDir(sysClassNet); e != nil {
+		return
+	}
+	for _, entry := range entries {
+		for _, marker := range []string{"wireless", "phy80211"} {
+			if _, err := os.Stat(filepath.Join(sysClassNet, entry.Name(), marker)); err == nil {
+				names = append(names, entry.Name())
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// DefaultInterface is first wireless interface which is not P2P group interface, wlan0 when
+// there is none.
+func DefaultInterface() string {
+	if names, err := WirelessInterfaces(); err == nil {
+		for _, name := range names {
+			if !strings.HasPrefix(name, "p2p-") {
+				return name
+			}
+		}
+	}
+	return defaultNetInterface
+}
+
+// netInterfaceOrDefault resolves interface name of managers, empty name stands for
+// DefaultInterface. It is resolved on every call, interface may appear after manager is created.
+func netInterfaceOrDefault(netInterface string) string {
+	if netInterface == "" {
+		return DefaultInterface()
+	}
+	return netInterface
+}
+
+func NewInterfaceManager() *interfaceManager {
+	return &interfaceManager{}
+}
+
+type interfaceManager struct {
+}
+
+var (
+	InterfaceManager = NewInterfaceManager()
+)
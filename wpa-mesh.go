@@ -0,0 +1,155 @@
+package wpaconnect
+
+import (
+	"context"
+	"net"
+
+	"github.com/godbus/dbus"
+	"github.com/mark2b/wpa-connect/internal/log"
+	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
+)
+
+type AdHocMode int
+
+const (
+	// AdHocMesh is 802.11s mesh (mode=5), peers are reported by Events.
+	AdHocMesh AdHocMode = iota
+	// AdHocIBSS is IBSS (mode=1), supplicant does not report IBSS peers.
+	AdHocIBSS
+)
+
+// AdHocConfig describes mesh or IBSS network. SSID is mesh ID of mesh network. Mesh is
+// secured by SAE and IBSS by WPA2-PSK when Password is set. Frequency in MHz takes
+// precedence over Channel, channel 6 is used when neither is set and unknown Channel fails
+// JoinAdHoc. Frequency of existing network found by scan is used when joining it.
+type AdHocConfig struct {
+	Mode      AdHocMode
+	SSID      string
+	Password  string
+	Frequency int
+	Channel   int
+	Address   *net.IPNet
+}
+
+// AdHocNetwork is mesh or IBSS network joined by JoinAdHoc. Joined is set when network
+// was found by scan, otherwise this device created it.
+type AdHocNetwork struct {
+	*hostedNetwork
+	Config    AdHocConfig
+	Frequency int
+	Joined    bool
+}
+
+// JoinAdHoc joins mesh or IBSS network found by scan, or creates it on configured frequency,
+// and waits until supplicant reports completed state. Station networks are disabled while
+// joined, Stop enables them again.
+func (self *connectManager) JoinAdHoc(ctx context.Context, config AdHocConfig) (network *AdHocNetwork, e error) {
+	var frequency int
+	if frequency, e = config.frequency(); e != nil {
+		return
+	}
+	self.removeIPConfig()
+	if wpa, err := wpa_dbus.NewWPAWithContext(ctx); err == nil {
+		if wpa.ReadInterface(self.netInterface()); wpa.Error == nil {
+			iface := wpa.Interface
+			network = &AdHocNetwork{hostedNetwork: newHostedNetwork(self.netInterface(), wpa, iface, config.Mode == AdHocMesh),
+				Config: config, Frequency: frequency}
+			if e = network.join(ctx, iface); e != nil {
+				network.Stop()
+				network = nil
+			}
+		} else {
+			e = wpa.Error
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+func (self *AdHocNetwork) join(ctx context.Context, iface *wpa_dbus.InterfaceWPA) (e error) {
+	if iface.ReadCapabilities(); iface.Error != nil {
+		return iface.Error
+	}
+	if !containsString(iface.ModeCapabilities, self.Config.Mode.String()) {
+		return ErrModeNotSupported
+	}
+	if self.Config.Mode == AdHocMesh && self.Config.Password != "" && !containsString(iface.KeyMgmtCapabilities, "sae") {
+		return ErrSAENotSupported
+	}
+	if _, e = NewScanManager(self.NetInterface).ScanContext(ctx); e != nil {
+		return
+	}
+	if bss := self.Config.findBSS(iface); bss != nil {
+		log.Log.Debug("Joining", bss.Mode, bss.BSSID, bss.Frequency)
+		self.Frequency = int(bss.Frequency)
+		self.Joined = true
+	}
+	if e = self.observe(iface); e == nil {
+		e = self.start(ctx, iface, self.Config.networkArgs(self.Frequency), self.Config.Address, ErrAssociationTimeout)
+	}
+	return
+}
+
+// findBSS looks for scanned network of same mode and SSID, mesh is matched by Mesh ID element.
+func (self *AdHocConfig) findBSS(iface *wpa_dbus.InterfaceWPA) *wpa_dbus.BSSWPA {
+	if iface.ReadBSSList().ReadBSSListProperties(); iface.Error != nil {
+		log.Log.Debug("Can't read BSS list", iface.Error)
+		iface.Error = nil
+		return nil
+	}
+	for _, bss := range iface.BSSs {
+		if bss.Error != nil || bss.Mode != self.Mode.String() {
+			continue
+		}
+		ssid := bss.SSID
+		if self.Mode == AdHocMesh {
+			ssid = parseInformationElements(bss.IEs).MeshID
+		}
+		if ssid == self.SSID {
+			return &bss
+		}
+	}
+	return nil
+}
+
+func (self *AdHocConfig) networkArgs(frequency int) map[string]dbus.Variant {
+	args := map[string]dbus.Variant{
+		"ssid":      dbus.MakeVariant(self.SSID),
+		"mode":      dbus.MakeVariant(self.Mode.networkMode()),
+		"frequency": dbus.MakeVariant(frequency),
+	}
+	switch {
+	case self.Password == "":
+		args["key_mgmt"] = dbus.MakeVariant("NONE")
+	case self.Mode == AdHocMesh:
+		args["key_mgmt"] = dbus.MakeVariant("SAE")
+		args["psk"] = dbus.MakeVariant(self.Password)
+	default:
+		args["key_mgmt"] = dbus.MakeVariant("WPA-PSK")
+		args["proto"] = dbus.MakeVariant("RSN")
+		args["pairwise"] = dbus.MakeVariant("CCMP")
+		args["group"] = dbus.MakeVariant("CCMP")
+		args["psk"] = dbus.MakeVariant(self.Password)
+	}
+	return args
+}
+
+func (self *AdHocConfig) frequency() (int, error) {
+	return hostedFrequency(self.Frequency, self.Channel)
+}
+
+func (self AdHocMode) networkMode() int {
+	if self == AdHocIBSS {
+		return 1
+	}
+	return 5
+}
+
+// String is name of mode as in interface Modes capability and Mode property of BSS.
+func (self AdHocMode) String() string {
+	if self == AdHocIBSS {
+		return "ad-hoc"
+	}
+	return "mesh"
+}
@@ -0,0 +1,500 @@
+package wpaconnect
+
+import (
+	"context"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/mark2b/wpa-connect/internal/log"
+	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
+)
+
+type P2PMethod int
+
+const (
+	// P2PPushButton uses WPS push-button on both devices.
+	P2PPushButton P2PMethod = iota
+	// P2PDisplayPin shows PIN on this device, it is entered on peer.
+	P2PDisplayPin
+	// P2PKeypadPin uses PIN displayed by peer.
+	P2PKeypadPin
+)
+
+type P2PPeer struct {
+	DeviceAddress string
+	DeviceName    string
+	Manufacturer  string
+	ModelName     string
+	ConfigMethods uint16
+	Level         int32
+	path          dbus.ObjectPath
+}
+
+// P2PGroup is group this device is member of. NetInterface is group interface created by
+// supplicant, e.g. p2p-wlan0-0. Role is GO or client.
+type P2PGroup struct {
+	NetInterface  string
+	Role          string
+	SSID          string
+	BSSID         string
+	Frequency     uint16
+	Passphrase    string
+	interfacePath dbus.ObjectPath
+}
+
+// P2PPersistentGroup is stored group which can be reinvoked without negotiation.
+type P2PPersistentGroup struct {
+	SSID  string
+	BSSID string
+	Mode  string
+	path  dbus.ObjectPath
+}
+
+// P2PConnectOptions selects WPS method of negotiation. With P2PDisplayPin and empty PIN
+// supplicant generates PIN, it is passed to OnPIN. GOIntent 1..15 is passed to negotiation,
+// 0 leaves supplicant default. Join connects to group peer already runs.
+type P2PConnectOptions struct {
+	Method     P2PMethod
+	PIN        string
+	GOIntent   int
+	Frequency  int
+	Persistent bool
+	Join       bool
+	OnPIN      func(pin string)
+}
+
+// P2PGroupOptions starts autonomous group owner, PersistentGroup reinvokes stored group.
+type P2PGroupOptions struct {
+	Persistent      bool
+	PersistentGroup *P2PPersistentGroup
+	Frequency       int
+}
+
+type P2PEventType int
+
+const (
+	P2PDeviceFound P2PEventType = iota
+	P2PDeviceLost
+	P2PFindStopped
+	// P2PNegotiationRequest is sent when peer wants to connect, answer it with Connect.
+	P2PNegotiationRequest
+	P2PPBCRequest
+	// P2PPinRequest carries PIN to display when peer requested it, empty PIN means PIN
+	// displayed by peer has to be entered.
+	P2PPinRequest
+	P2PGroupStarted
+	P2PGroupFinished
+	P2PGroupFormationFailed
+	P2PNegotiationFailed
+	P2PPersistentGroupAdded
+	P2PPersistentGroupRemoved
+)
+
+func (self P2PEventType) String() string {
+	switch self {
+	case P2PDeviceFound:
+		return "device_found"
+	case P2PDeviceLost:
+		return "device_lost"
+	case P2PFindStopped:
+		return "find_stopped"
+	case P2PNegotiationRequest:
+		return "negotiation_request"
+	case P2PPBCRequest:
+		return "pbc_request"
+	case P2PPinRequest:
+		return "pin_request"
+	case P2PGroupStarted:
+		return "group_started"
+	case P2PGroupFinished:
+		return "group_finished"
+	case P2PGroupFormationFailed:
+		return "group_formation_failed"
+	case P2PNegotiationFailed:
+		return "negotiation_failed"
+	case P2PPersistentGroupAdded:
+		return "persistent_group_added"
+	case P2PPersistentGroupRemoved:
+		return "persistent_group_removed"
+	}
+	return "unknown"
+}
+
+// P2PEvent is sent by P2P Watch. Error is set for failed negotiation and group formation.
+type P2PEvent struct {
+	Type            P2PEventType
+	Peer            *P2PPeer
+	Group           *P2PGroup
+	PersistentGroup *P2PPersistentGroup
+	PIN             string
+	Error           error
+}
+
+type p2pWatcher struct {
+	iface   *wpa_dbus.InterfaceWPA
+	signals chan *dbus.Signal
+	events  chan P2PEvent
+	peers   map[dbus.ObjectPath]P2PPeer
+}
+
+// Find starts device discovery, found devices are reported by Watch. Discovery runs
+// until StopFind when timeout is 0.
+func (self *p2pManager) Find(timeout time.Duration) error {
+	return withInterface(self.netInterface(), func(iface *wpa_dbus.InterfaceWPA) error {
+		args := map[string]dbus.Variant{}
+		if timeout > 0 {
+			args["Timeout"] = dbus.MakeVariant(int32(timeout / time.Second))
+		}
+		return iface.P2PFind(args).Error
+	})
+}
+
+func (self *p2pManager) StopFind() error {
+	return withInterface(self.netInterface(), func(iface *wpa_dbus.InterfaceWPA) error {
+		return iface.P2PStopFind().Error
+	})
+}
+
+// Peers returns devices discovered by Find.
+func (self *p2pManager) Peers() (peers []P2PPeer, e error) {
+	e = withInterface(self.netInterface(), func(iface *wpa_dbus.InterfaceWPA) error {
+		if iface.ReadP2PPeers(); iface.Error != nil {
+			return iface.Error
+		}
+		for _, peer := range iface.P2PPeers {
+			if peer.ReadProperties(); peer.Error == nil {
+				peers = append(peers, newP2PPeer(&peer))
+			} else {
+				log.Log.Debug("Can't read peer", peer.Object.Path(), peer.Error)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// Watch streams P2P events of interface until ctx is done, channel is closed then.
+func (self *p2pManager) Watch(ctx context.Context) (events <-chan P2PEvent, e error) {
+	var watcher *p2pWatcher
+	if watcher, e = self.watch(ctx); e == nil {
+		events = watcher.events
+	}
+	return
+}
+
+func (self *p2pManager) watch(ctx context.Context) (watcher *p2pWatcher, e error) {
+	if wpa, err := wpa_dbus.NewWPAWithContext(ctx); err == nil {
+		if wpa.ReadInterface(self.netInterface()); wpa.Error == nil {
+			watcher = &p2pWatcher{iface: wpa.Interface, signals: make(chan *dbus.Signal, 64),
+				events: make(chan P2PEvent, 16), peers: make(map[dbus.ObjectPath]P2PPeer)}
+			wpa.WaitForSignals(watcher.onSignal)
+			if wpa.Interface.AddP2PSignalsObserver(); wpa.Interface.Error == nil {
+				go watcher.run(ctx)
+			} else {
+				e = wpa.Interface.Error
+				wpa.StopWaitForSignals()
+				watcher = nil
+			}
+		} else {
+			e = wpa.Error
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+// Connect negotiates group with peer and waits until group is started.
+func (self *p2pManager) Connect(ctx context.Context, peer P2PPeer, options P2PConnectOptions) (group P2PGroup, e error) {
+	args := map[string]dbus.Variant{"peer": dbus.MakeVariant(peer.path), "persistent": dbus.MakeVariant(options.Persistent),
+		"join": dbus.MakeVariant(options.Join)}
+	switch options.Method {
+	case P2PDisplayPin:
+		args["wps_method"] = dbus.MakeVariant("display")
+	case P2PKeypadPin:
+		args["wps_method"] = dbus.MakeVariant("keypad")
+	default:
+		args["wps_method"] = dbus.MakeVariant("pbc")
+	}
+	if options.PIN != "" {
+		args["pin"] = dbus.MakeVariant(options.PIN)
+	}
+	if options.GOIntent > 0 {
+		args["go_intent"] = dbus.MakeVariant(int32(options.GOIntent))
+	}
+	if options.Frequency > 0 {
+		args["frequency"] = dbus.MakeVariant(int32(options.Frequency))
+	}
+	return self.startGroup(ctx, func(iface *wpa_dbus.InterfaceWPA) error {
+		if iface.P2PConnect(args); iface.Error == nil && iface.P2PGeneratedPin != "" && options.OnPIN != nil {
+			options.OnPIN(iface.P2PGeneratedPin)
+		}
+		return iface.Error
+	})
+}
+
+// StartGroup starts group with this device as group owner and waits until it is up.
+func (self *p2pManager) StartGroup(ctx context.Context, options P2PGroupOptions) (group P2PGroup, e error) {
+	args := map[string]dbus.Variant{"persistent": dbus.MakeVariant(options.Persistent)}
+	if options.PersistentGroup != nil {
+		args["persistent_group_object"] = dbus.MakeVariant(options.PersistentGroup.path)
+	}
+	if options.Frequency > 0 {
+		args["frequency"] = dbus.MakeVariant(int32(options.Frequency))
+	}
+	return self.startGroup(ctx, func(iface *wpa_dbus.InterfaceWPA) error {
+		return iface.P2PGroupAdd(args).Error
+	})
+}
+
+// Invite reinvokes persistent group with peer and waits until group is started.
+func (self *p2pManager) Invite(ctx context.Context, peer P2PPeer, persistentGroup P2PPersistentGroup) (group P2PGroup, e error) {
+	args := map[string]dbus.Variant{"peer": dbus.MakeVariant(peer.path),
+		"persistent_group_object": dbus.MakeVariant(persistentGroup.path)}
+	return self.startGroup(ctx, func(iface *wpa_dbus.InterfaceWPA) error {
+		return iface.P2PInvite(args).Error
+	})
+}
+
+// startGroup runs request and waits for group started or failure events.
+func (self *p2pManager) startGroup(ctx context.Context, request func(*wpa_dbus.InterfaceWPA) error) (group P2PGroup, e error) {
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var watcher *p2pWatcher
+	if watcher, e = self.watch(watchCtx); e != nil {
+		return
+	}
+	if e = request(watcher.iface); e != nil {
+		return
+	}
+	for {
+		select {
+		case event, ok := <-watcher.events:
+			if !ok {
+				e = phaseError(ctx, ErrP2PTimeout)
+				return
+			}
+			switch event.Type {
+			case P2PGroupStarted:
+				group = *event.Group
+				return
+			case P2PGroupFormationFailed, P2PNegotiationFailed:
+				e = event.Error
+				return
+			}
+		case <-ctx.Done():
+			if iface := watcher.iface.Detached(); iface.P2PCancel().Error != nil {
+				log.Log.Debug("Can't cancel P2P negotiation", iface.Error)
+			}
+			e = phaseError(ctx, ErrP2PTimeout)
+			return
+		}
+	}
+}
+
+// RemoveGroup terminates group, this device leaves it or stops being group owner.
+func (self *p2pManager) RemoveGroup(group P2PGroup) (e error) {
+	if wpa, err := wpa_dbus.NewWPA(); err == nil {
+		iface := wpa_dbus.InterfaceWPA{WPA: wpa, Object: wpa.Connection.Object("fi.w1.wpa_supplicant1", group.interfacePath)}
+		e = iface.P2PDisconnect().Error
+	} else {
+		e = err
+	}
+	return
+}
+
+func (self *p2pManager) PersistentGroups() (groups []P2PPersistentGroup, e error) {
+	e = withInterface(self.netInterface(), func(iface *wpa_dbus.InterfaceWPA) error {
+		if iface.ReadPersistentGroups(); iface.Error != nil {
+			return iface.Error
+		}
+		for _, group := range iface.PersistentGroups {
+			if group.ReadProperties(); group.Error != nil {
+				return group.Error
+			}
+			groups = append(groups, newP2PPersistentGroup(&group))
+		}
+		return nil
+	})
+	return
+}
+
+func (self *p2pManager) RemovePersistentGroup(group P2PPersistentGroup) error {
+	return withInterface(self.netInterface(), func(iface *wpa_dbus.InterfaceWPA) error {
+		return iface.RemovePersistentGroup(group.path).Error
+	})
+}
+
+func (self *p2pManager) RemoveAllPersistentGroups() error {
+	return withInterface(self.netInterface(), func(iface *wpa_dbus.InterfaceWPA) error {
+		return iface.RemoveAllPersistentGroups().Error
+	})
+}
+
+// onSignal forwards signals of P2P device interface.
+func (self *p2pWatcher) onSignal(wpa *wpa_dbus.WPA, signal *dbus.Signal) {
+	if signal.Path == self.iface.Object.Path() {
+		forwardSignal(self.signals, signal, "P2P watch")
+	}
+}
+
+func (self *p2pWatcher) run(ctx context.Context) {
+	defer func() {
+		self.iface.RemoveP2PSignalsObserver()
+		self.iface.WPA.StopWaitForSignals()
+		close(self.events)
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case signal := <-self.signals:
+			if event, ok := self.processSignal(signal); ok {
+				select {
+				case self.events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+func (self *p2pWatcher) processSignal(signal *dbus.Signal) (event P2PEvent, ok bool) {
+	log.Log.Debug(signal.Name, signal.Body)
+	ok = true
+	switch signal.Name {
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.DeviceFound":
+		event = P2PEvent{Type: P2PDeviceFound, Peer: self.peer(signalPath(signal, 0), true)}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.DeviceLost":
+		path := signalPath(signal, 0)
+		event = P2PEvent{Type: P2PDeviceLost, Peer: self.peer(path, false)}
+		delete(self.peers, path)
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.FindStopped":
+		event = P2PEvent{Type: P2PFindStopped}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.GONegotiationRequest":
+		event = P2PEvent{Type: P2PNegotiationRequest, Peer: self.peer(signalPath(signal, 0), false)}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.ProvisionDiscoveryPBCRequest":
+		event = P2PEvent{Type: P2PPBCRequest, Peer: self.peer(signalPath(signal, 0), false)}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.ProvisionDiscoveryRequestDisplayPin":
+		event = P2PEvent{Type: P2PPinRequest, Peer: self.peer(signalPath(signal, 0), false)}
+		if len(signal.Body) > 1 {
+			event.PIN, _ = signal.Body[1].(string)
+		}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.ProvisionDiscoveryRequestEnterPin":
+		event = P2PEvent{Type: P2PPinRequest, Peer: self.peer(signalPath(signal, 0), false)}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.GroupStarted":
+		event = P2PEvent{Type: P2PGroupStarted, Group: self.group(signalArgs(signal, 0))}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.GroupFinished":
+		event = P2PEvent{Type: P2PGroupFinished, Group: self.group(signalArgs(signal, 0))}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.GroupFormationFailure":
+		p2pError := &P2PError{Stage: "group_formation"}
+		if len(signal.Body) > 0 {
+			p2pError.Reason, _ = signal.Body[0].(string)
+		}
+		event = P2PEvent{Type: P2PGroupFormationFailed, Error: p2pError}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.GONegotiationFailure":
+		p2pError := &P2PError{Stage: "go_negotiation"}
+		p2pError.Status, _ = signalArgs(signal, 0)["status"].Value().(int32)
+		event = P2PEvent{Type: P2PNegotiationFailed, Error: p2pError}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.ProvisionDiscoveryFailure":
+		p2pError := &P2PError{Stage: "provision_discovery"}
+		if len(signal.Body) > 1 {
+			p2pError.Status, _ = signal.Body[1].(int32)
+		}
+		event = P2PEvent{Type: P2PNegotiationFailed, Peer: self.peer(signalPath(signal, 0), false), Error: p2pError}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.WpsFailed":
+		p2pError := &P2PError{Stage: "wps"}
+		if len(signal.Body) > 0 {
+			p2pError.Reason, _ = signal.Body[0].(string)
+		}
+		event = P2PEvent{Type: P2PNegotiationFailed, Error: p2pError}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.PersistentGroupAdded":
+		group := wpa_dbus.PersistentGroupWPA{Interface: self.iface,
+			Object: self.iface.WPA.Connection.Object("fi.w1.wpa_supplicant1", signalPath(signal, 0))}
+		persistentGroup := P2PPersistentGroup{path: group.Object.Path()}
+		if group.ReadProperties(); group.Error == nil {
+			persistentGroup = newP2PPersistentGroup(&group)
+		}
+		event = P2PEvent{Type: P2PPersistentGroupAdded, PersistentGroup: &persistentGroup}
+	case "fi.w1.wpa_supplicant1.Interface.P2PDevice.PersistentGroupRemoved":
+		event = P2PEvent{Type: P2PPersistentGroupRemoved, PersistentGroup: &P2PPersistentGroup{path: signalPath(signal, 0)}}
+	default:
+		ok = false
+	}
+	return
+}
+
+// peer returns peer known to watcher, properties are read for new peers or when refresh is set.
+func (self *p2pWatcher) peer(path dbus.ObjectPath, refresh bool) *P2PPeer {
+	peer, known := self.peers[path]
+	if !known || refresh {
+		peerWPA := wpa_dbus.PeerWPA{Interface: self.iface, Object: self.iface.WPA.Connection.Object("fi.w1.wpa_supplicant1", path)}
+		if peerWPA.ReadProperties(); peerWPA.Error == nil {
+			peer = newP2PPeer(&peerWPA)
+			self.peers[path] = peer
+		} else {
+			peer = P2PPeer{path: path}
+		}
+	}
+	return &peer
+}
+
+func (self *p2pWatcher) group(args map[string]dbus.Variant) *P2PGroup {
+	group := &P2PGroup{}
+	group.Role, _ = args["role"].Value().(string)
+	group.interfacePath, _ = args["interface_object"].Value().(dbus.ObjectPath)
+	iface := &wpa_dbus.InterfaceWPA{WPA: self.iface.WPA, Object: self.iface.WPA.Connection.Object("fi.w1.wpa_supplicant1", group.interfacePath)}
+	if iface.ReadIfname(); iface.Error == nil {
+		group.NetInterface = iface.Ifname
+	}
+	if groupPath, ok := args["group_object"].Value().(dbus.ObjectPath); ok {
+		groupWPA := wpa_dbus.GroupWPA{Interface: iface, Object: self.iface.WPA.Connection.Object("fi.w1.wpa_supplicant1", groupPath)}
+		if groupWPA.ReadProperties(); groupWPA.Error == nil {
+			group.SSID = groupWPA.SSID
+			group.BSSID = groupWPA.BSSID
+			group.Frequency = groupWPA.Frequency
+			group.Passphrase = groupWPA.Passphrase
+		}
+	}
+	return group
+}
+
+func signalPath(signal *dbus.Signal, index int) (path dbus.ObjectPath) {
+	if len(signal.Body) > index {
+		path, _ = signal.Body[index].(dbus.ObjectPath)
+	}
+	return
+}
+
+func signalArgs(signal *dbus.Signal, index int) (args map[string]dbus.Variant) {
+	if len(signal.Body) > index {
+		args, _ = signal.Body[index].(map[string]dbus.Variant)
+	}
+	return
+}
+
+func newP2PPeer(peer *wpa_dbus.PeerWPA) P2PPeer {
+	return P2PPeer{DeviceAddress: peer.DeviceAddress, DeviceName: peer.DeviceName, Manufacturer: peer.Manufacturer,
+		ModelName: peer.ModelName, ConfigMethods: peer.ConfigMethod, Level: peer.Level, path: peer.Object.Path()}
+}
+
+func newP2PPersistentGroup(group *wpa_dbus.PersistentGroupWPA) P2PPersistentGroup {
+	return P2PPersistentGroup{SSID: group.SSID, BSSID: group.BSSID, Mode: group.Properties["mode"], path: group.Object.Path()}
+}
+
+func NewP2PManager(netInterface string) *p2pManager {
+	return &p2pManager{NetInterface: netInterface}
+}
+
+func (self *p2pManager) netInterface() string {
+	return netInterfaceOrDefault(self.NetInterface)
+}
+
+type p2pManager struct {
+	NetInterface string
+}
+
+var (
+	P2PManager = NewP2PManager("")
+)
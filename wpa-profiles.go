@@ -0,0 +1,173 @@
+package wpaconnect
+
+import (
+	"strconv"
+
+	"github.com/godbus/dbus"
+	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
+)
+
+// List returns networks saved in supplicant configuration.
+func (self *profileManager) List() (profiles []NetworkProfile, e error) {
+	e = withInterface(self.netInterface(), func(iface *wpa_dbus.InterfaceWPA) (e error) {
+		if networks, err := readNetworks(iface); err == nil {
+			for _, network := range networks {
+				profiles = append(profiles, newNetworkProfile(&network))
+			}
+		} else {
+			e = err
+		}
+		return
+	})
+	return
+}
+
+// Save adds network for ssid or updates existing one, other networks are left untouched.
+func (self *profileManager) Save(ssid string, credentials Credentials) (e error) {
+	e = self.withInterface(func(iface *wpa_dbus.InterfaceWPA) (e error) {
+		if args, err := networkArgsForInterface(iface, &wpa_dbus.BSSWPA{SSID: ssid}, credentials, false); err == nil {
+			if networks, err := readNetworks(iface); err == nil {
+				_, _, e = saveNetwork(iface, networks, ssid, args)
+			} else {
+				e = err
+			}
+		} else {
+			e = err
+		}
+		return
+	})
+	return
+}
+
+// Forget removes network saved for ssid.
+func (self *profileManager) Forget(ssid string) (e error) {
+	e = self.withNetwork(ssid, func(network *wpa_dbus.NetworkWPA) error {
+		return network.Remove().Error
+	})
+	return
+}
+
+func (self *profileManager) Enable(ssid string) (e error) {
+	e = self.withNetwork(ssid, func(network *wpa_dbus.NetworkWPA) error {
+		return network.SetEnabled(true).Error
+	})
+	return
+}
+
+func (self *profileManager) Disable(ssid string) (e error) {
+	e = self.withNetwork(ssid, func(network *wpa_dbus.NetworkWPA) error {
+		return network.SetEnabled(false).Error
+	})
+	return
+}
+
+func (self *profileManager) withNetwork(ssid string, callBack func(*wpa_dbus.NetworkWPA) error) (e error) {
+	e = self.withInterface(func(iface *wpa_dbus.InterfaceWPA) (e error) {
+		if networks, err := readNetworks(iface); err == nil {
+			if network := findNetwork(networks, ssid); network != nil {
+				e = callBack(network)
+			} else {
+				e = ErrProfileNotFound
+			}
+		} else {
+			e = err
+		}
+		return
+	})
+	return
+}
+
+// withInterface runs callBack on supplicant interface and saves configuration when it succeeds.
+// Change applied by callBack stays in running supplicant when save fails, NotPersistedError
+// tells so.
+func (self *profileManager) withInterface(callBack func(*wpa_dbus.InterfaceWPA) error) (e error) {
+	e = withInterface(self.netInterface(), func(iface *wpa_dbus.InterfaceWPA) (e error) {
+		if e = callBack(iface); e == nil {
+			if err := saveConfig(iface); err != nil {
+				e = &NotPersistedError{Err: err}
+			}
+		}
+		return
+	})
+	return
+}
+
+// readNetworks reads properties and enabled state of all networks configured on interface.
+func readNetworks(iface *wpa_dbus.InterfaceWPA) (networks []wpa_dbus.NetworkWPA, e error) {
+	if iface.ReadNetworksList(); iface.Error == nil {
+		for _, network := range iface.Networks {
+			if network.ReadProperties().ReadEnabled(); network.Error == nil {
+				networks = append(networks, network)
+			} else {
+				e = network.Error
+				return
+			}
+		}
+	} else {
+		e = iface.Error
+	}
+	return
+}
+
+func findNetwork(networks []wpa_dbus.NetworkWPA, ssid string) *wpa_dbus.NetworkWPA {
+	for i := range networks {
+		if networks[i].SSID == ssid {
+			return &networks[i]
+		}
+	}
+	return nil
+}
+
+// saveNetwork updates properties of network configured for ssid or adds new network. It is
+// used by Save only, Connect adds network of its own and replaces profile once connected.
+func saveNetwork(iface *wpa_dbus.InterfaceWPA, networks []wpa_dbus.NetworkWPA, ssid string, args map[string]dbus.Variant) (network *wpa_dbus.NetworkWPA, created bool, e error) {
+	if network = findNetwork(networks, ssid); network != nil {
+		if network.SetProperties(args); network.Error != nil {
+			e = network.Error
+		}
+	} else if iface.AddNetwork(args); iface.Error == nil {
+		network = iface.NewNetwork
+		created = true
+	} else {
+		e = iface.Error
+	}
+	return
+}
+
+func newNetworkProfile(network *wpa_dbus.NetworkWPA) (profile NetworkProfile) {
+	profile = NetworkProfile{SSID: network.SSID, KeyMgmt: network.KeyMgmt, Enabled: network.Enabled,
+		Hidden: network.Properties["scan_ssid"] == "1"}
+	if priority, err := strconv.Atoi(network.Properties["priority"]); err == nil {
+		profile.Priority = priority
+	}
+	return
+}
+
+// Profiles lists networks saved for interface of connect manager, see profileManager.List.
+func (self *connectManager) Profiles() ([]NetworkProfile, error) {
+	return NewProfileManager(self.netInterface()).List()
+}
+
+func NewProfileManager(netInterface string) *profileManager {
+	return &profileManager{NetInterface: netInterface}
+}
+
+func (self *profileManager) netInterface() string {
+	return netInterfaceOrDefault(self.NetInterface)
+}
+
+type NetworkProfile struct {
+	SSID     string
+	KeyMgmt  string
+	Enabled  bool
+	Hidden   bool
+	Priority int
+}
+
+type profileManager struct {
+	NetInterface string
+}
+
+var (
+	ProfileManager = NewProfileManager("")
+)
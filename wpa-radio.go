@@ -0,0 +1,109 @@
+package wpaconnect
+
+// Band is frequency band of channel.
+type Band int
+
+const (
+	BandUnknown Band = iota
+	Band2GHz
+	Band5GHz
+	Band6GHz
+)
+
+func (self Band) String() string {
+	switch self {
+	case Band2GHz:
+		return "2.4GHz"
+	case Band5GHz:
+		return "5GHz"
+	case Band6GHz:
+		return "6GHz"
+	}
+	return "unknown"
+}
+
+// FrequencyBand returns band of center frequency in MHz.
+func FrequencyBand(frequency int) Band {
+	switch {
+	case frequency >= 2412 && frequency <= 2484:
+		return Band2GHz
+	case frequency >= 5150 && frequency <= 5895:
+		return Band5GHz
+	case frequency >= 5925 && frequency <= 7125:
+		return Band6GHz
+	}
+	return BandUnknown
+}
+
+// FrequencyChannel returns channel number of center frequency in MHz, 0 when unknown. Channel
+// numbers of 6 GHz band overlap with 5 GHz ones, FrequencyBand tells them apart.
+func FrequencyChannel(frequency int) int {
+	switch FrequencyBand(frequency) {
+	case Band2GHz:
+		if frequency == 2484 {
+			return 14
+		}
+		return (frequency - 2407) / 5
+	case Band5GHz:
+		return (frequency - 5000) / 5
+	case Band6GHz:
+		if frequency == 5935 {
+			return 2
+		}
+		return (frequency - 5950) / 5
+	}
+	return 0
+}
+
+// ChannelFrequency returns center frequency in MHz of 20 MHz channel in band, 0 when unknown.
+// Numbers between 20 MHz channels, e.g. 5 GHz 38 of 40 MHz channel, are not accepted.
+func ChannelFrequency(band Band, channel int) int {
+	switch {
+	case band == Band2GHz && channel >= 1 && channel <= 13:
+		return 2407 + channel*5
+	case band == Band2GHz && channel == 14:
+		return 2484
+	case band == Band5GHz && channel >= 32 && channel <= 144 && channel%4 == 0,
+		band == Band5GHz && channel >= 149 && channel <= 177 && channel%4 == 1:
+		return 5000 + channel*5
+	case band == Band6GHz && channel == 2:
+		return 5935
+	case band == Band6GHz && channel >= 1 && channel <= 233 && channel%4 == 1:
+		return 5950 + channel*5
+	}
+	return 0
+}
+
+// channelFrequency returns center frequency in MHz of 2.4 GHz or 5 GHz channel, 0 when unknown.
+func channelFrequency(channel int) int {
+	if channel <= 14 {
+		return ChannelFrequency(Band2GHz, channel)
+	}
+	return ChannelFrequency(Band5GHz, channel)
+}
+
+// SignalQuality maps signal in dBm to percents, linearly from -100 dBm to -50 dBm.
+func SignalQuality(signal int) int {
+	switch {
+	case signal <= -100:
+		return 0
+	case signal >= -50:
+		return 100
+	}
+	return 2 * (signal + 100)
+}
+
+// SignalBars maps signal in dBm to 0-4 bars of signal indicator.
+func SignalBars(signal int) int {
+	switch {
+	case signal >= -55:
+		return 4
+	case signal >= -67:
+		return 3
+	case signal >= -78:
+		return 2
+	case signal >= -89:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,44 @@
+package wpaconnect
+
+import "testing"
+
+func TestChannelFrequency(t *testing.T) {
+	tests := []struct {
+		band    Band
+		channel int
+		want    int
+	}{
+		{Band2GHz, 1, 2412},
+		{Band2GHz, 13, 2472},
+		{Band2GHz, 14, 2484},
+		{Band2GHz, 0, 0},
+		{Band2GHz, 15, 0},
+		{Band5GHz, 32, 5160},
+		{Band5GHz, 36, 5180},
+		{Band5GHz, 144, 5720},
+		{Band5GHz, 149, 5745},
+		{Band5GHz, 165, 5825},
+		{Band5GHz, 177, 5885},
+		{Band5GHz, 33, 0},
+		{Band5GHz, 35, 0},
+		{Band5GHz, 38, 0},
+		{Band5GHz, 145, 0},
+		{Band5GHz, 148, 0},
+		{Band5GHz, 181, 0},
+		{Band6GHz, 1, 5955},
+		{Band6GHz, 2, 5935},
+		{Band6GHz, 233, 7115},
+		{Band6GHz, 3, 0},
+		{Band6GHz, 4, 0},
+		{Band6GHz, 235, 0},
+	}
+	for _, test := range tests {
+		if got := ChannelFrequency(test.band, test.channel); got != test.want {
+			t.Errorf("ChannelFrequency(%v, %d) = %d, want %d", test.band, test.channel, got, test.want)
+		}
+	}
+	options := ScanOptions{Channels: []int{36, 38}}
+	if _, err := options.args(); err == nil {
+		t.Error("scan of channel 38 is accepted")
+	}
+}
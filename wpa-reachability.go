@@ -0,0 +1,208 @@
+package wpaconnect
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type Reachability int
+
+const (
+	ReachabilityUnknown Reachability = iota
+	ReachabilityOnline
+	ReachabilityCaptivePortal
+	ReachabilityNoInternet
+)
+
+func (self Reachability) String() string {
+	switch self {
+	case ReachabilityOnline:
+		return "online"
+	case ReachabilityCaptivePortal:
+		return "captive_portal"
+	case ReachabilityNoInternet:
+		return "no_internet"
+	}
+	return "unknown"
+}
+
+// ReachabilityResult is outcome of reachability check. PortalURL is set for captive portal,
+// it is redirect location or probe URL when portal answered it directly. Error is last
+// probe error when there is no internet.
+type ReachabilityResult struct {
+	Reachability Reachability
+	PortalURL    string
+	Checked      time.Time
+	Error        error
+}
+
+// ReachabilityChecker checks internet access through interface.
+type ReachabilityChecker interface {
+	Check(ctx context.Context, netInterface string) ReachabilityResult
+}
+
+// Probe is URL which answers with ExpectedStatus, and with ExpectedBody when it is not empty.
+type Probe struct {
+	URL            string
+	ExpectedStatus int
+	ExpectedBody   string
+}
+
+// HTTPChecker requests probes in order without following redirects, first expected answer
+// means online. Unexpected answer or redirect means captive portal, no answer at all means
+// no internet. Requests are bound to interface unless Client is set, redirects are not followed
+// with Client either.
+type HTTPChecker struct {
+	Probes  []Probe
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+const (
+	defaultProbeTimeout    = time.Second * 10
+	defaultProbeBodyLength = 4096
+)
+
+var DefaultProbes = []Probe{
+	{URL: "http://connectivitycheck.gstatic.com/generate_204", ExpectedStatus: http.StatusNoContent},
+	{URL: "http://www.msftconnecttest.com/connecttest.txt", ExpectedStatus: http.StatusOK, ExpectedBody: "Microsoft Connect Test"},
+}
+
+func NewHTTPChecker() *HTTPChecker {
+	return &HTTPChecker{Probes: DefaultProbes, Timeout: defaultProbeTimeout}
+}
+
+func (self *HTTPChecker) Check(ctx context.Context, netInterface string) (result ReachabilityResult) {
+	client := self.client(netInterface)
+	result.Reachability = ReachabilityNoInternet
+	for _, probe := range self.Probes {
+		reachability, portalURL, err := self.probe(ctx, client, &probe)
+		if err != nil {
+			result.Error = err
+			continue
+		}
+		if reachability == ReachabilityOnline {
+			result = ReachabilityResult{Reachability: reachability}
+			break
+		}
+		// First portal answer is kept, other probes may still get through
+		if result.Reachability != ReachabilityCaptivePortal {
+			result = ReachabilityResult{Reachability: reachability, PortalURL: portalURL}
+		}
+	}
+	result.Checked = time.Now()
+	return
+}
+
+func (self *HTTPChecker) probe(ctx context.Context, client *http.Client, probe *Probe) (reachability Reachability, portalURL string, e error) {
+	if self.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, self.Timeout)
+		defer cancel()
+	}
+	var request *http.Request
+	if request, e = http.NewRequestWithContext(ctx, http.MethodGet, probe.URL, nil); e != nil {
+		return
+	}
+	request.Header.Set("Cache-Control", "no-cache")
+	var response *http.Response
+	if response, e = client.Do(request); e != nil {
+		return
+	}
+	defer response.Body.Close()
+	var body []byte
+	if body, e = ioutil.ReadAll(io.LimitReader(response.Body, defaultProbeBodyLength)); e != nil {
+		return
+	}
+	if response.StatusCode == probe.ExpectedStatus &&
+		(probe.ExpectedBody == "" || strings.TrimSpace(string(body)) == probe.ExpectedBody) {
+		reachability = ReachabilityOnline
+		return
+	}
+	reachability = ReachabilityCaptivePortal
+	portalURL = probe.URL
+	if location, err := response.Location(); err == nil {
+		portalURL = location.String()
+	}
+	return
+}
+
+// client returns copy of Client with redirects disabled, or client bound to netInterface when
+// Client is not set.
+func (self *HTTPChecker) client(netInterface string) *http.Client {
+	if self.Client != nil {
+		client := *self.Client
+		client.CheckRedirect = noRedirect
+		return &client
+	}
+	dialer := &net.Dialer{Control: func(network, address string, rawConn syscall.RawConn) (e error) {
+		if netInterface == "" {
+			return
+		}
+		if err := rawConn.Control(func(fd uintptr) {
+			e = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, netInterface)
+		}); err != nil {
+			e = err
+		}
+		return
+	}}
+	return &http.Client{
+		Transport:     &http.Transport{DialContext: dialer.DialContext, DisableKeepAlives: true},
+		CheckRedirect: noRedirect,
+	}
+}
+
+func noRedirect(request *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// CheckReachability runs ReachabilityCheck, or HTTPChecker with default probes when it is not set.
+func (self *connectManager) CheckReachability(ctx context.Context) ReachabilityResult {
+	return self.reachabilityChecker().Check(ctx, self.netInterface())
+}
+
+// WatchReachability checks reachability every interval until ctx is done. First result is
+// always sent, then only changes. Channel is closed when ctx is done.
+func (self *connectManager) WatchReachability(ctx context.Context, interval time.Duration) <-chan ReachabilityResult {
+	results := make(chan ReachabilityResult, 1)
+	checker := self.reachabilityChecker()
+	go func() {
+		defer close(results)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var previous *ReachabilityResult
+		for {
+			result := checker.Check(ctx, self.netInterface())
+			if ctx.Err() != nil {
+				return
+			}
+			if previous == nil || previous.Reachability != result.Reachability || previous.PortalURL != result.PortalURL {
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+				previous = &result
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return results
+}
+
+func (self *connectManager) reachabilityChecker() ReachabilityChecker {
+	if self.ReachabilityCheck != nil {
+		return self.ReachabilityCheck
+	}
+	return NewHTTPChecker()
+}
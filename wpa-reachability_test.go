@@ -0,0 +1,75 @@
+package wpaconnect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newProbeServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/generate_204", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/portal/login", http.StatusFound)
+	})
+	mux.HandleFunc("/portal/login", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>Sign in</html>")
+	})
+	mux.HandleFunc("/connecttest.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Microsoft Connect Test\n")
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestHTTPCheckerCheck(t *testing.T) {
+	server := newProbeServer()
+	defer server.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	tests := []struct {
+		name      string
+		probes    []Probe
+		want      Reachability
+		portalURL string
+	}{
+		{"204", []Probe{{URL: server.URL + "/generate_204", ExpectedStatus: http.StatusNoContent}},
+			ReachabilityOnline, ""},
+		{"200 with expected body", []Probe{{URL: server.URL + "/connecttest.txt", ExpectedStatus: http.StatusOK,
+			ExpectedBody: "Microsoft Connect Test"}}, ReachabilityOnline, ""},
+		{"redirect to portal", []Probe{{URL: server.URL + "/redirect", ExpectedStatus: http.StatusNoContent}},
+			ReachabilityCaptivePortal, server.URL + "/portal/login"},
+		{"200 with portal body", []Probe{{URL: server.URL + "/portal/login", ExpectedStatus: http.StatusNoContent}},
+			ReachabilityCaptivePortal, server.URL + "/portal/login"},
+		{"200 with unexpected body", []Probe{{URL: server.URL + "/portal/login", ExpectedStatus: http.StatusOK,
+			ExpectedBody: "Microsoft Connect Test"}}, ReachabilityCaptivePortal, server.URL + "/portal/login"},
+		{"no answer", []Probe{{URL: closed.URL + "/generate_204", ExpectedStatus: http.StatusNoContent}},
+			ReachabilityNoInternet, ""},
+		{"next probe gets through", []Probe{{URL: closed.URL + "/generate_204", ExpectedStatus: http.StatusNoContent},
+			{URL: server.URL + "/redirect", ExpectedStatus: http.StatusNoContent},
+			{URL: server.URL + "/generate_204", ExpectedStatus: http.StatusNoContent}}, ReachabilityOnline, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Client of test server follows redirects, checker must not
+			client := server.Client()
+			checker := &HTTPChecker{Probes: test.probes, Client: client}
+			result := checker.Check(context.Background(), "")
+			if result.Reachability != test.want || result.PortalURL != test.portalURL {
+				t.Errorf("got %s %q, want %s %q", result.Reachability, result.PortalURL, test.want, test.portalURL)
+			}
+			if (result.Error != nil) != (test.want == ReachabilityNoInternet) {
+				t.Errorf("unexpected error %v", result.Error)
+			}
+			if result.Checked.IsZero() {
+				t.Error("Checked is not set")
+			}
+			if client.CheckRedirect != nil {
+				t.Error("caller's client is modified")
+			}
+		})
+	}
+}
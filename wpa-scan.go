@@ -1,31 +1,69 @@
 package wpaconnect
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/godbus/dbus"
 	"github.com/mark2b/wpa-connect/internal/log"
 	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
 )
 
+const defaultScanTimeout = time.Second * 30
+
 func (self *scanManager) Scan() (bssList []BSS, e error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultScanTimeout)
+	defer cancel()
+	return self.ScanContext(ctx)
+}
+
+// ScanContext triggers passive scan and waits for results until ctx is done.
+func (self *scanManager) ScanContext(ctx context.Context) (bssList []BSS, e error) {
+	return self.ScanWithOptions(ctx, ScanOptions{})
+}
+
+// ScanWithOptions triggers scan narrowed by options and waits for results until ctx is done.
+// Results include networks supplicant still keeps from earlier scans, unless they are filtered
+// out by Bands or MinQuality. ErrScanFailed is returned when supplicant reports failed scan.
+func (self *scanManager) ScanWithOptions(ctx context.Context, options ScanOptions) (bssList []BSS, e error) {
+	var args map[string]dbus.Variant
+	if args, e = options.args(); e != nil {
+		return
+	}
 	self.scanContext = &scanContext{}
-	self.scanContext.scanDone = make(chan bool)
-	if wpa, err := wpa_dbus.NewWPA(); err == nil {
+	self.scanContext.scanDone = make(chan bool, 1)
+	if wpa, err := wpa_dbus.NewWPAWithContext(ctx); err == nil {
 		wpa.WaitForSignals(self.onScanSignal)
-		if wpa.ReadInterface(self.NetInterface); wpa.Error == nil {
+		if wpa.ReadInterface(self.netInterface()); wpa.Error == nil {
 			iface := wpa.Interface
+			self.scanContext.setInterface(iface.Object.Path())
 			iface.AddSignalsObserver()
-			self.scanContext.phaseWaitForScanDone = true
-			if iface.Scan(); iface.Error == nil {
-				// Wait for scan_example done
-				<-self.scanContext.scanDone
-				if iface.ReadBSSList(); iface.Error == nil {
-					for _, bss := range iface.BSSs {
-						if bss.ReadBSSID().ReadSSID().ReadRSN().ReadMode().ReadSignal().
-							ReadFrequency().ReadPrivacy().ReadAge().ReadWPS().ReadWPA(); bss.Error == nil {
-							bssList = append(bssList, BSS{BSSID: bss.BSSID, SSID: bss.SSID, KeyMgmt: bss.RSNKeyMgmt, WPS: bss.WPS,
-								Frequency: bss.Frequency, Privacy: bss.Privacy, Age: bss.Age, Mode: bss.Mode, Signal: bss.Signal})
+			self.scanContext.setPhaseWaitForScanDone(true)
+			if iface.ScanWithArgs(args); iface.Error == nil {
+				// Wait for scan done
+				select {
+				case success := <-self.scanContext.scanDone:
+					if !success {
+						e = ErrScanFailed
+					} else if iface.ReadBSSList().ReadBSSListProperties(); iface.Error == nil {
+						for _, bss := range iface.BSSs {
+							if bss.Error == nil {
+								if bss := newBSS(&bss); options.accepts(&bss) {
+									bssList = append(bssList, bss)
+								}
+							} else if ctx.Err() != nil {
+								e = ctx.Err()
+								break
+							}
 						}
+					} else {
+						e = iface.Error
 					}
+				case <-ctx.Done():
+					e = phaseError(ctx, ErrScanTimeout)
 				}
 			} else {
 				e = iface.Error
@@ -38,11 +76,17 @@ func (self *scanManager) Scan() (bssList []BSS, e error) {
 	} else {
 		e = err
 	}
+	SortBSS(bssList, options.Order)
 	return
 }
 
+// onScanSignal handles signals of scanned interface only, bus connection is shared with
+// watchers and other interfaces.
 func (self *scanManager) onScanSignal(wpa *wpa_dbus.WPA, signal *dbus.Signal) {
 	log.Log.Debug(signal.Name, signal.Path)
+	if !self.scanContext.isInterface(signal.Path) {
+		return
+	}
 	switch signal.Name {
 	case "fi.w1.wpa_supplicant1.Interface.BSSAdded":
 	case "fi.w1.wpa_supplicant1.Interface.BSSRemoved":
@@ -55,11 +99,133 @@ func (self *scanManager) onScanSignal(wpa *wpa_dbus.WPA, signal *dbus.Signal) {
 	}
 }
 
+// processScanDone passes success argument of ScanDone, it is false when driver rejected
+// or aborted scan.
 func (self *scanManager) processScanDone(wpa *wpa_dbus.WPA, signal *dbus.Signal) {
-	log.Log.Debug("processScanDone")
-	if self.scanContext.phaseWaitForScanDone {
-		self.scanContext.phaseWaitForScanDone = false
-		self.scanContext.scanDone <- true
+	log.Log.Debug("processScanDone", signal.Body)
+	success := true
+	if len(signal.Body) > 0 {
+		if value, ok := signal.Body[0].(bool); ok {
+			success = value
+		}
+	}
+	if self.scanContext.setPhaseWaitForScanDone(false) {
+		select {
+		case self.scanContext.scanDone <- success:
+		default:
+		}
+	}
+}
+
+func (self *scanContext) setInterface(path dbus.ObjectPath) {
+	self.Lock()
+	defer self.Unlock()
+	self.path = path
+}
+
+func (self *scanContext) isInterface(path dbus.ObjectPath) bool {
+	self.Lock()
+	defer self.Unlock()
+	return self.path != "" && self.path == path
+}
+
+func (self *scanContext) setPhaseWaitForScanDone(value bool) bool {
+	self.Lock()
+	defer self.Unlock()
+	changed := self.phaseWaitForScanDone != value
+	self.phaseWaitForScanDone = value
+	return changed
+}
+
+func newBSS(bss *wpa_dbus.BSSWPA) BSS {
+	return BSS{
+		BSSID:     bss.BSSID,
+		SSID:      bss.SSID,
+		KeyMgmt:   bss.RSNKeyMgmt,
+		RSN:       SecurityDetails{KeyMgmt: bss.RSNKeyMgmt, Pairwise: bss.RSNPairwise, Group: bss.RSNGroup, MgmtGroup: bss.RSNMgmtGroup},
+		WPA:       SecurityDetails{KeyMgmt: bss.WPAKeyMgmt, Pairwise: bss.WPAPairwise, Group: bss.WPAGroup},
+		Security:  bssSecurity(bss),
+		WPS:       bss.WPS,
+		Frequency: bss.Frequency,
+		Channel:   FrequencyChannel(int(bss.Frequency)),
+		Band:      FrequencyBand(int(bss.Frequency)),
+		Signal:    bss.Signal,
+		Quality:   SignalQuality(int(bss.Signal)),
+		Bars:      SignalBars(int(bss.Signal)),
+		Age:       bss.Age,
+		Mode:      bss.Mode,
+		Privacy:   bss.Privacy,
+		Elements:  parseInformationElements(bss.IEs),
+	}
+}
+
+func (self *ScanOptions) args() (args map[string]dbus.Variant, e error) {
+	args = map[string]dbus.Variant{"Type": dbus.MakeVariant("passive")}
+	if self.Active || len(self.SSIDs) > 0 {
+		args["Type"] = dbus.MakeVariant("active")
+	}
+	if len(self.SSIDs) > 0 {
+		ssids := [][]byte{}
+		for _, ssid := range self.SSIDs {
+			if len(ssid) > 32 {
+				return nil, fmt.Errorf("SSID %q is longer than 32 bytes", ssid)
+			}
+			ssids = append(ssids, []byte(ssid))
+		}
+		args["SSIDs"] = dbus.MakeVariant(ssids)
+	}
+	channels := []scanChannel{}
+	for _, frequency := range self.Frequencies {
+		channels = append(channels, scanChannel{Frequency: uint32(frequency), Width: 20})
+	}
+	for _, channel := range self.Channels {
+		if frequency := channelFrequency(channel); frequency != 0 {
+			channels = append(channels, scanChannel{Frequency: uint32(frequency), Width: 20})
+		} else {
+			return nil, fmt.Errorf("unknown channel %d", channel)
+		}
+	}
+	if len(channels) > 0 {
+		args["Channels"] = dbus.MakeVariant(channels)
+	}
+	if len(self.IEs) > 0 {
+		args["IEs"] = dbus.MakeVariant([][]byte{self.IEs})
+	}
+	if self.NoRoam {
+		args["AllowRoam"] = dbus.MakeVariant(false)
+	}
+	return
+}
+
+// accepts tells whether BSS passes Bands and MinQuality filters.
+func (self *ScanOptions) accepts(bss *BSS) bool {
+	if len(self.Bands) > 0 {
+		accepted := false
+		for _, band := range self.Bands {
+			accepted = accepted || band == bss.Band
+		}
+		if !accepted {
+			return false
+		}
+	}
+	return bss.Quality >= self.MinQuality
+}
+
+// SortBSS sorts scan results in order, ties keep order of supplicant.
+func SortBSS(bssList []BSS, order BSSOrder) {
+	switch order {
+	case OrderBySignal:
+		sort.SliceStable(bssList, func(i, j int) bool {
+			return bssList[i].Signal > bssList[j].Signal
+		})
+	case OrderByChannel:
+		sort.SliceStable(bssList, func(i, j int) bool {
+			return bssList[i].Frequency < bssList[j].Frequency
+		})
+	case OrderBySSID:
+		sort.SliceStable(bssList, func(i, j int) bool {
+			return bssList[i].SSID < bssList[j].SSID
+		})
 	}
 }
 
@@ -67,19 +233,71 @@ func NewScanManager(netInterface string) *scanManager {
 	return &scanManager{NetInterface: netInterface}
 }
 
+func (self *scanManager) netInterface() string {
+	return netInterfaceOrDefault(self.NetInterface)
+}
+
+// BSS is scanned network. KeyMgmt is key management of RSN element, same as RSN.KeyMgmt.
+// Signal is in dBm, Quality is signal in percents and Bars is 0-4 bars of signal indicator.
 type BSS struct {
 	BSSID     string
 	SSID      string
 	KeyMgmt   []string
+	RSN       SecurityDetails
+	WPA       SecurityDetails
+	Security  Security
 	WPS       string
 	Frequency uint16
+	Channel   int
+	Band      Band
 	Signal    int16
+	Quality   int
+	Bars      int
 	Age       uint32
 	Mode      string
 	Privacy   bool
+	Elements  InformationElements
+}
+
+// BSSOrder is order of scan results.
+type BSSOrder int
+
+const (
+	// OrderNone keeps order of supplicant.
+	OrderNone BSSOrder = iota
+	// OrderBySignal puts strongest network first.
+	OrderBySignal
+	// OrderByChannel orders by frequency, i.e. by band and channel.
+	OrderByChannel
+	OrderBySSID
+)
+
+// ScanOptions narrows scan. Scan is passive unless Active is set or SSIDs are given, directed
+// probes for SSIDs find hidden networks. Frequencies in MHz and Channels restrict scan to
+// 20 MHz channels, all supported channels are scanned when both are empty. IEs are added to
+// probe requests. NoRoam keeps supplicant from roaming on results of this scan. Results are
+// filtered by Bands and MinQuality in percents and sorted in Order.
+type ScanOptions struct {
+	Active      bool
+	SSIDs       []string
+	Frequencies []int
+	Channels    []int
+	IEs         []byte
+	NoRoam      bool
+	Bands       []Band
+	MinQuality  int
+	Order       BSSOrder
+}
+
+// scanChannel is (center frequency, width) pair of Channels scan argument.
+type scanChannel struct {
+	Frequency uint32
+	Width     uint32
 }
 
 type scanContext struct {
+	sync.Mutex
+	path                 dbus.ObjectPath
 	phaseWaitForScanDone bool
 	scanDone             chan bool
 }
@@ -90,5 +308,5 @@ type scanManager struct {
 }
 
 var (
-	ScanManager = &scanManager{NetInterface: "wlan0"}
+	ScanManager = NewScanManager("")
 )
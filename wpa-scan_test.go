@@ -0,0 +1,30 @@
+package wpaconnect
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus"
+)
+
+func TestProcessScanDone(t *testing.T) {
+	for _, test := range []struct {
+		body []interface{}
+		want bool
+	}{
+		{[]interface{}{true}, true},
+		{[]interface{}{false}, false},
+		{nil, true},
+	} {
+		manager := &scanManager{scanContext: &scanContext{scanDone: make(chan bool, 1)}}
+		manager.scanContext.setPhaseWaitForScanDone(true)
+		manager.processScanDone(nil, &dbus.Signal{Name: "fi.w1.wpa_supplicant1.Interface.ScanDone", Body: test.body})
+		select {
+		case success := <-manager.scanContext.scanDone:
+			if success != test.want {
+				t.Errorf("%v: got %v, want %v", test.body, success, test.want)
+			}
+		default:
+			t.Errorf("%v: scan done is not notified", test.body)
+		}
+	}
+}
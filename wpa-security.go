@@ -0,0 +1,101 @@
+package wpaconnect
+
+import (
+	"strings"
+
+	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
+)
+
+// Security is security of network derived from RSN and WPA elements of BSS.
+type Security int
+
+const (
+	// SecurityUnknown is security of network which was not scanned, e.g. hidden one.
+	SecurityUnknown Security = iota
+	SecurityOpen
+	SecurityOWE
+	SecurityWEP
+	SecurityWPA
+	SecurityWPA2Personal
+	SecurityWPA3Personal
+	// SecurityWPA2WPA3Transition accepts both WPA2-PSK and SAE.
+	SecurityWPA2WPA3Transition
+	SecurityEnterprise
+)
+
+func (self Security) String() string {
+	switch self {
+	case SecurityOpen:
+		return "open"
+	case SecurityOWE:
+		return "owe"
+	case SecurityWEP:
+		return "wep"
+	case SecurityWPA:
+		return "wpa"
+	case SecurityWPA2Personal:
+		return "wpa2-personal"
+	case SecurityWPA3Personal:
+		return "wpa3-personal"
+	case SecurityWPA2WPA3Transition:
+		return "wpa2-wpa3-transition"
+	case SecurityEnterprise:
+		return "enterprise"
+	}
+	return "unknown"
+}
+
+// SecurityDetails is RSN or WPA element of BSS as reported by supplicant, e.g. KeyMgmt
+// "wpa-psk" and "sae", Pairwise "ccmp", Group "ccmp", MgmtGroup "aes128cmac". MgmtGroup
+// is RSN only.
+type SecurityDetails struct {
+	KeyMgmt   []string
+	Pairwise  []string
+	Group     string
+	MgmtGroup string
+}
+
+// classifySecurity derives security from key management of RSN and WPA elements, WPA element
+// is looked at only when there is no RSN key management. Privacy without either is WEP.
+func classifySecurity(privacy bool, rsnKeyMgmt []string, wpaKeyMgmt []string) Security {
+	keyMgmt := rsnKeyMgmt
+	if len(keyMgmt) == 0 {
+		keyMgmt = wpaKeyMgmt
+	}
+	var hasPSK, hasSAE, hasOWE bool
+	for _, value := range keyMgmt {
+		switch {
+		case strings.Contains(value, "eap") || strings.Contains(value, "fils") || value == "ieee8021x":
+			return SecurityEnterprise
+		case strings.Contains(value, "psk"):
+			hasPSK = true
+		case strings.Contains(value, "sae"):
+			hasSAE = true
+		case value == "owe":
+			hasOWE = true
+		}
+	}
+	switch {
+	case len(rsnKeyMgmt) == 0 && hasPSK:
+		return SecurityWPA
+	case hasSAE && hasPSK:
+		return SecurityWPA2WPA3Transition
+	case hasSAE:
+		return SecurityWPA3Personal
+	case hasPSK:
+		return SecurityWPA2Personal
+	case hasOWE:
+		return SecurityOWE
+	case privacy:
+		return SecurityWEP
+	}
+	return SecurityOpen
+}
+
+// bssSecurity classifies scanned BSS, BSS without object, i.e. hidden or not scanned, is unknown.
+func bssSecurity(bss *wpa_dbus.BSSWPA) Security {
+	if bss.Object == nil {
+		return SecurityUnknown
+	}
+	return classifySecurity(bss.Privacy, bss.RSNKeyMgmt, bss.WPAKeyMgmt)
+}
@@ -0,0 +1,143 @@
+package wpaconnect
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/mark2b/wpa-connect/internal/log"
+	"github.com/mark2b/wpa-connect/internal/netlink"
+)
+
+const defaultResolvConf = "/etc/resolv.conf"
+
+// StaticIPConfig is applied to interface once supplicant reports completed state.
+// Addresses carry prefix length, e.g. 192.168.1.10/24. DNS servers are written to
+// ResolvConf (/etc/resolv.conf when empty), previous content is restored on removal.
+type StaticIPConfig struct {
+	IP4        *net.IPNet
+	Gateway4   net.IP
+	IP6        *net.IPNet
+	Gateway6   net.IP
+	DNS        []net.IP
+	ResolvConf string
+}
+
+// appliedStaticIP remembers configuration applied to interface so it can be removed on disconnect.
+type appliedStaticIP struct {
+	config            StaticIPConfig
+	index             int
+	resolvConf        []byte
+	resolvConfWritten bool
+}
+
+func (self *StaticIPConfig) apply(netInterface string) (applied *appliedStaticIP, e error) {
+	var netIface *net.Interface
+	if netIface, e = net.InterfaceByName(netInterface); e != nil {
+		return
+	}
+	applied = &appliedStaticIP{config: *self, index: netIface.Index}
+	for _, address := range []*net.IPNet{self.IP4, self.IP6} {
+		if address != nil {
+			if e = netlink.AddAddress(netIface.Index, address); e != nil {
+				e = fmt.Errorf("can't add address %s: %w", address, e)
+				break
+			}
+		}
+	}
+	if e == nil {
+		for _, gateway := range []net.IP{self.Gateway4, self.Gateway6} {
+			if gateway != nil {
+				if e = netlink.AddDefaultRoute(netIface.Index, gateway); e != nil {
+					e = fmt.Errorf("can't add default route via %s: %w", gateway, e)
+					break
+				}
+			}
+		}
+	}
+	if e == nil && len(self.DNS) > 0 {
+		e = applied.writeResolvConf()
+	}
+	if e != nil {
+		applied.remove()
+		applied = nil
+	}
+	return
+}
+
+func (self *appliedStaticIP) writeResolvConf() (e error) {
+	path := self.resolvConfPath()
+	if content, err := ioutil.ReadFile(path); err == nil {
+		self.resolvConf = content
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	var content bytes.Buffer
+	content.WriteString("# Generated by wpa-connect\n")
+	for _, server := range self.config.DNS {
+		fmt.Fprintf(&content, "nameserver %s\n", server)
+	}
+	if e = ioutil.WriteFile(path, content.Bytes(), 0644); e == nil {
+		self.resolvConfWritten = true
+	}
+	return
+}
+
+// remove deletes addresses and routes, errors are logged as interface may be already gone.
+func (self *appliedStaticIP) remove() {
+	for _, gateway := range []net.IP{self.config.Gateway4, self.config.Gateway6} {
+		if gateway != nil {
+			if err := netlink.DeleteDefaultRoute(self.index, gateway); err != nil {
+				log.Log.Debug("Can't delete default route", gateway, err)
+			}
+		}
+	}
+	for _, address := range []*net.IPNet{self.config.IP4, self.config.IP6} {
+		if address != nil {
+			if err := netlink.DeleteAddress(self.index, address); err != nil {
+				log.Log.Debug("Can't delete address", address, err)
+			}
+		}
+	}
+	if self.resolvConfWritten {
+		var err error
+		if self.resolvConf != nil {
+			err = ioutil.WriteFile(self.resolvConfPath(), self.resolvConf, 0644)
+		} else {
+			err = os.Remove(self.resolvConfPath())
+		}
+		if err != nil {
+			log.Log.Warning("Can't restore", self.resolvConfPath(), err)
+		}
+	}
+}
+
+func (self *appliedStaticIP) resolvConfPath() string {
+	if self.config.ResolvConf != "" {
+		return self.config.ResolvConf
+	}
+	return defaultResolvConf
+}
+
+func (self *StaticIPConfig) equal(other *StaticIPConfig) bool {
+	if ipNetString(self.IP4) != ipNetString(other.IP4) || ipNetString(self.IP6) != ipNetString(other.IP6) ||
+		!self.Gateway4.Equal(other.Gateway4) || !self.Gateway6.Equal(other.Gateway6) ||
+		len(self.DNS) != len(other.DNS) || self.ResolvConf != other.ResolvConf {
+		return false
+	}
+	for i := range self.DNS {
+		if !self.DNS[i].Equal(other.DNS[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func ipNetString(ipNet *net.IPNet) string {
+	if ipNet == nil {
+		return ""
+	}
+	return ipNet.String()
+}
@@ -0,0 +1,81 @@
+package wpaconnect
+
+import (
+	"net"
+
+	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
+)
+
+// Status returns supplicant state of interface, current network and IP addresses.
+// SSID, BSSID, Frequency and Signal are empty when interface is not associated.
+func (self *connectManager) Status() (status Status, e error) {
+	status.NetInterface = self.netInterface()
+	e = withInterface(self.netInterface(), func(iface *wpa_dbus.InterfaceWPA) (e error) {
+		if iface.ReadState().ReadCurrentBSS(); iface.Error == nil {
+			status.State = iface.State
+			if bss := iface.CurrentBSS; bss.Object.Path() != "/" {
+				if bss.ReadProperties(); bss.Error == nil {
+					status.SSID = bss.SSID
+					status.BSSID = bss.BSSID
+					status.Frequency = bss.Frequency
+					status.Signal = bss.Signal
+				} else {
+					e = bss.Error
+				}
+			}
+		} else {
+			e = iface.Error
+		}
+		return
+	})
+	if e == nil {
+		status.Addresses, e = interfaceAddresses(self.netInterface())
+	}
+	return
+}
+
+// Disconnect disconnects interface from current network and removes static IP configuration
+// or DHCP lease applied by Connect. Supplicant does not reconnect until Reconnect or Connect is called.
+func (self *connectManager) Disconnect() (e error) {
+	// Lease is released while link is still up
+	self.removeIPConfig()
+	e = withInterface(self.netInterface(), func(iface *wpa_dbus.InterfaceWPA) error {
+		return iface.Disconnect().Error
+	})
+	return
+}
+
+// Reconnect connects interface to one of enabled networks after Disconnect.
+func (self *connectManager) Reconnect() (e error) {
+	e = withInterface(self.netInterface(), func(iface *wpa_dbus.InterfaceWPA) error {
+		return iface.Reconnect().Error
+	})
+	return
+}
+
+func interfaceAddresses(netInterface string) (addresses []net.IP, e error) {
+	if netIface, err := net.InterfaceByName(netInterface); err == nil {
+		if addrs, err := netIface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				if ip, _, err := net.ParseCIDR(addr.String()); err == nil {
+					addresses = append(addresses, ip)
+				}
+			}
+		} else {
+			e = err
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+type Status struct {
+	NetInterface string
+	State        string
+	SSID         string
+	BSSID        string
+	Frequency    uint16
+	Signal       int16
+	Addresses    []net.IP
+}
@@ -0,0 +1,170 @@
+package wpaconnect
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/mark2b/wpa-connect/internal/log"
+)
+
+// Run keeps interface connected to one of preferred networks until ctx is done. Networks are tried
+// in order, supervisor falls through to next one after FailuresPerNetwork consecutive failures.
+// Delay between attempts grows exponentially from MinBackoff to MaxBackoff with random jitter.
+// Every attempt goes through ConnectManager, so its address and save settings apply and
+// DHCP lease of previous attempt is released by the next one.
+func (self *supervisor) Run(ctx context.Context) (e error) {
+	if len(self.Networks) == 0 {
+		return ErrNoPreferredNetworks
+	}
+	index := 0
+	failures := 0
+	consecutiveFailures := 0
+	for ctx.Err() == nil {
+		if status, err := self.ConnectManager.Status(); err == nil && status.State == "completed" {
+			self.waitForDisconnect(ctx)
+			continue
+		}
+		network := self.Networks[index]
+		attempt := Attempt{NetInterface: self.ConnectManager.netInterface(), SSID: network.SSID, Number: consecutiveFailures + 1,
+			Started: time.Now()}
+		if self.OnAttempt != nil {
+			self.OnAttempt(attempt)
+		}
+		connectCtx, cancel := context.WithTimeout(ctx, self.ConnectTimeout)
+		info, err := self.ConnectManager.ConnectContext(connectCtx, network.SSID, network.Credentials)
+		cancel()
+		if self.OnResult != nil {
+			self.OnResult(AttemptResult{Attempt: attempt, ConnectionInfo: info, Error: err})
+		}
+		if err == nil {
+			// Once link is lost, networks are tried in order of preference again
+			index = 0
+			failures = 0
+			consecutiveFailures = 0
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		log.Log.Warning("Connect failed", network.SSID, err)
+		consecutiveFailures++
+		if failures++; failures >= self.FailuresPerNetwork {
+			failures = 0
+			index = (index + 1) % len(self.Networks)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(self.backoff(consecutiveFailures)):
+		}
+	}
+	e = ctx.Err()
+	return
+}
+
+// waitForDisconnect returns when link is down and supplicant did not restore it within GracePeriod.
+func (self *supervisor) waitForDisconnect(ctx context.Context) {
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := self.ConnectManager.Watch(watchCtx)
+	if err != nil {
+		log.Log.Warning("Can't watch interface", self.ConnectManager.netInterface(), err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(self.GracePeriod):
+		}
+		return
+	}
+	var grace <-chan time.Time
+	// Link could drop between status check and subscription
+	if status, err := self.ConnectManager.Status(); err != nil || status.State != "completed" {
+		grace = time.After(self.GracePeriod)
+	}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Type == EventStateChanged {
+				if event.State == "completed" {
+					grace = nil
+				} else if grace == nil {
+					grace = time.After(self.GracePeriod)
+				}
+			}
+		case <-grace:
+			return
+		}
+	}
+}
+
+func (self *supervisor) backoff(failures int) time.Duration {
+	delay := self.MinBackoff
+	for i := 1; i < failures && delay < self.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > self.MaxBackoff {
+		delay = self.MaxBackoff
+	}
+	if self.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * self.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// NewSupervisor creates supervisor with defaults suitable for headless devices, connections are
+// made by connectManager configured by caller.
+func NewSupervisor(connectManager *connectManager, networks []PreferredNetwork) *supervisor {
+	return &supervisor{
+		ConnectManager:     connectManager,
+		Networks:           networks,
+		ConnectTimeout:     time.Second * 60,
+		GracePeriod:        time.Second * 15,
+		MinBackoff:         time.Second * 2,
+		MaxBackoff:         time.Minute * 5,
+		Jitter:             0.2,
+		FailuresPerNetwork: 3,
+	}
+}
+
+type PreferredNetwork struct {
+	SSID        string
+	Credentials Credentials
+}
+
+type Attempt struct {
+	NetInterface string
+	SSID         string
+	Number       int
+	Started      time.Time
+}
+
+type AttemptResult struct {
+	Attempt
+	ConnectionInfo ConnectionInfo
+	Error          error
+}
+
+// supervisedManager is connectManager as seen by supervisor.
+type supervisedManager interface {
+	ConnectContext(ctx context.Context, ssid string, credentials Credentials) (ConnectionInfo, error)
+	Status() (Status, error)
+	Watch(ctx context.Context) (<-chan Event, error)
+	netInterface() string
+}
+
+type supervisor struct {
+	ConnectManager supervisedManager
+	Networks       []PreferredNetwork
+	// ConnectTimeout limits single connection attempt.
+	ConnectTimeout time.Duration
+	// GracePeriod is time given to supplicant to restore dropped link by itself.
+	GracePeriod        time.Duration
+	MinBackoff         time.Duration
+	MaxBackoff         time.Duration
+	Jitter             float64
+	FailuresPerNetwork int
+	OnAttempt          func(Attempt)
+	OnResult           func(AttemptResult)
+}
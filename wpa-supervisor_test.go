@@ -0,0 +1,88 @@
+package wpaconnect
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeManager connects to SSIDs of reachable, link drops as soon as supervisor watches it.
+type fakeManager struct {
+	sync.Mutex
+	reachable map[string]bool
+	connected bool
+	attempts  []string
+}
+
+func (self *fakeManager) ConnectContext(ctx context.Context, ssid string, credentials Credentials) (ConnectionInfo, error) {
+	self.Lock()
+	defer self.Unlock()
+	self.attempts = append(self.attempts, ssid)
+	if !self.reachable[ssid] {
+		return ConnectionInfo{}, ErrNetworkNotFound
+	}
+	self.connected = true
+	return ConnectionInfo{NetInterface: "wlan0", SSID: ssid}, nil
+}
+
+func (self *fakeManager) Status() (Status, error) {
+	self.Lock()
+	defer self.Unlock()
+	if self.connected {
+		return Status{NetInterface: "wlan0", State: "completed"}, nil
+	}
+	return Status{NetInterface: "wlan0", State: "disconnected"}, nil
+}
+
+func (self *fakeManager) Watch(ctx context.Context) (<-chan Event, error) {
+	self.Lock()
+	defer self.Unlock()
+	self.connected = false
+	events := make(chan Event, 1)
+	events <- Event{Type: EventStateChanged, State: "disconnected"}
+	return events, nil
+}
+
+func (self *fakeManager) netInterface() string {
+	return "wlan0"
+}
+
+func TestSupervisorRun(t *testing.T) {
+	manager := &fakeManager{reachable: map[string]bool{"backup": true}}
+	supervisor := NewSupervisor(nil, []PreferredNetwork{{SSID: "office"}, {SSID: "backup"}})
+	supervisor.ConnectManager = manager
+	supervisor.GracePeriod = time.Millisecond
+	supervisor.MinBackoff = time.Millisecond
+	supervisor.MaxBackoff = time.Millisecond
+	supervisor.FailuresPerNetwork = 2
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	var results []AttemptResult
+	supervisor.OnResult = func(result AttemptResult) {
+		if results = append(results, result); len(results) == 6 {
+			cancel()
+		}
+	}
+	if err := supervisor.Run(ctx); err != context.Canceled {
+		t.Fatalf("Run: got %v, want context.Canceled", err)
+	}
+	// Preferred network is tried first again after backup link drops
+	want := []string{"office", "office", "backup", "office", "office", "backup"}
+	if !reflect.DeepEqual(manager.attempts, want) {
+		t.Errorf("attempts = %v, want %v", manager.attempts, want)
+	}
+	for i, number := range []int{1, 2, 3, 1, 2, 3} {
+		if results[i].Number != number || results[i].NetInterface != "wlan0" {
+			t.Errorf("attempt %d: %+v", i, results[i].Attempt)
+		}
+		if (results[i].Error == nil) != (want[i] == "backup") || (results[i].Error != nil && !errors.Is(results[i].Error, ErrNetworkNotFound)) {
+			t.Errorf("attempt %d: error %v", i, results[i].Error)
+		}
+	}
+	if err := NewSupervisor(nil, nil).Run(ctx); err != ErrNoPreferredNetworks {
+		t.Errorf("Run without networks: got %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+package wpaconnect
+
+import (
+	"context"
+	"net"
+
+	"github.com/godbus/dbus"
+	"github.com/mark2b/wpa-connect/internal/log"
+	"github.com/mark2b/wpa-connect/internal/netlink"
+	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
+)
+
+// Watch streams connection events of interface until ctx is done, channel is closed then. It is
+// closed as well when address notifications can't be received anymore.
+func (self *connectManager) Watch(ctx context.Context) (events <-chan Event, e error) {
+	var netIface *net.Interface
+	if netIface, e = net.InterfaceByName(self.netInterface()); e != nil {
+		return
+	}
+	var conn *netlink.Conn
+	if conn, e = netlink.Dial(netlink.GroupIPv4Address | netlink.GroupIPv6Address); e != nil {
+		return
+	}
+	if wpa, err := wpa_dbus.NewWPAWithContext(ctx); err == nil {
+		if wpa.ReadInterface(self.netInterface()); wpa.Error == nil {
+			iface := wpa.Interface
+			watcher := &watcher{NetInterface: self.netInterface(), index: netIface.Index, iface: iface, netlink: conn,
+				signals: make(chan *dbus.Signal, 64), addressMessages: make(chan []netlink.Message, 16),
+				addressesLost: make(chan bool, 1), events: make(chan Event, 16)}
+			wpa.WaitForSignals(watcher.onSignal)
+			if iface.AddSignalsObserver(); iface.Error == nil {
+				go watcher.receiveAddresses(ctx)
+				go watcher.run(ctx)
+				events = watcher.events
+			} else {
+				e = iface.Error
+				wpa.StopWaitForSignals()
+			}
+		} else {
+			e = wpa.Error
+		}
+	} else {
+		e = err
+	}
+	if e != nil {
+		conn.Close()
+	}
+	return
+}
+
+// onSignal forwards signals of watched interface.
+func (self *watcher) onSignal(wpa *wpa_dbus.WPA, signal *dbus.Signal) {
+	if signal.Path == self.iface.Object.Path() {
+		forwardSignal(self.signals, signal, "Watch")
+	}
+}
+
+// forwardSignal hands signal over to watcher goroutine, signal callbacks must not block D-Bus
+// connection. Signal is dropped when watcher falls behind.
+func forwardSignal(signals chan<- *dbus.Signal, signal *dbus.Signal, watcher string) {
+	select {
+	case signals <- signal:
+	default:
+		log.Log.Warning(watcher+" is too slow, signal dropped", signal.Name)
+	}
+}
+
+// receiveAddresses forwards rtnetlink notifications until connection is closed by run. Lost
+// notifications are reported on addressesLost, addressMessages is closed on other errors.
+func (self *watcher) receiveAddresses(ctx context.Context) {
+	defer close(self.addressMessages)
+	for {
+		if messages, err := self.netlink.Receive(); err == nil {
+			select {
+			case self.addressMessages <- messages:
+			case <-ctx.Done():
+				return
+			}
+		} else if netlink.IsOverrun(err) {
+			select {
+			case self.addressesLost <- true:
+			default:
+			}
+		} else {
+			if ctx.Err() == nil {
+				log.Log.Warning("Watch can't receive address notifications", self.NetInterface, err)
+			}
+			return
+		}
+	}
+}
+
+func (self *watcher) run(ctx context.Context) {
+	defer func() {
+		self.netlink.Close()
+		self.iface.RemoveSignalsObserver()
+		self.iface.WPA.StopWaitForSignals()
+		close(self.events)
+	}()
+	if self.iface.ReadState(); self.iface.Error == nil {
+		self.state = self.iface.State
+	}
+	if addresses, err := netlink.ListAddresses(self.index); err == nil {
+		for _, address := range addresses {
+			self.addresses = append(self.addresses, address.IP)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case signal := <-self.signals:
+			if signal.Name == "fi.w1.wpa_supplicant1.Interface.PropertiesChanged" && len(signal.Body) > 0 {
+				if properties, ok := signal.Body[0].(map[string]dbus.Variant); ok {
+					self.processPropertiesChanged(ctx, properties)
+				}
+			}
+		case messages, ok := <-self.addressMessages:
+			if !ok {
+				return
+			}
+			self.processAddresses(ctx, messages)
+		case <-self.addressesLost:
+			self.syncAddresses(ctx)
+		}
+	}
+}
+
+func (self *watcher) processPropertiesChanged(ctx context.Context, properties map[string]dbus.Variant) {
+	if value, ok := properties["DisconnectReason"].Value().(int32); ok {
+		self.disconnectReason = value
+	}
+	if path, ok := properties["CurrentBSS"].Value().(dbus.ObjectPath); ok && path != self.currentBSS {
+		self.currentBSS = path
+		event := Event{Type: EventBSSChanged, State: self.state}
+		if path != "/" {
+			bss := wpa_dbus.BSSWPA{Interface: self.iface, Object: self.iface.WPA.Connection.Object("fi.w1.wpa_supplicant1", path)}
+			if bss.ReadProperties(); bss.Error == nil {
+				event.BSSID = bss.BSSID
+				event.SSID = bss.SSID
+				event.Frequency = bss.Frequency
+			}
+		}
+		self.emit(ctx, event)
+	}
+	if state, ok := properties["State"].Value().(string); ok && state != self.state {
+		previous := self.state
+		self.state = state
+		self.emit(ctx, Event{Type: EventStateChanged, State: state, PreviousState: previous})
+		if state == "disconnected" {
+			self.emit(ctx, Event{Type: EventDisconnected, State: state, PreviousState: previous,
+				Disconnect: newDisconnectError(self.disconnectReason)})
+		}
+	}
+}
+
+func (self *watcher) processAddresses(ctx context.Context, messages []netlink.Message) {
+	for _, message := range messages {
+		if address := message.Address; address != nil && address.Index == self.index {
+			known := containsIP(self.addresses, address.IP)
+			if message.Deleted && known {
+				self.addresses = removeIP(self.addresses, address.IP)
+				self.emit(ctx, Event{Type: EventAddressRemoved, State: self.state, Address: address.IP})
+			} else if !message.Deleted && !known {
+				self.addresses = append(self.addresses, address.IP)
+				self.emit(ctx, Event{Type: EventAddressAdded, State: self.state, Address: address.IP})
+			}
+		}
+	}
+}
+
+// syncAddresses reads addresses again after notifications were lost and emits the difference.
+func (self *watcher) syncAddresses(ctx context.Context) {
+	if addresses, err := netlink.ListAddresses(self.index); err == nil {
+		messages := []netlink.Message{}
+		for _, ip := range self.addresses {
+			if !containsAddress(addresses, ip) {
+				messages = append(messages, netlink.Message{Address: &netlink.Address{Index: self.index, IP: ip}, Deleted: true})
+			}
+		}
+		for i := range addresses {
+			messages = append(messages, netlink.Message{Address: &addresses[i]})
+		}
+		self.processAddresses(ctx, messages)
+	} else {
+		log.Log.Warning("Watch can't read addresses", self.NetInterface, err)
+	}
+}
+
+func (self *watcher) emit(ctx context.Context, event Event) {
+	event.NetInterface = self.NetInterface
+	select {
+	case self.events <- event:
+	case <-ctx.Done():
+	}
+}
+
+func removeIP(addresses []net.IP, address net.IP) (result []net.IP) {
+	for _, a := range addresses {
+		if !a.Equal(address) {
+			result = append(result, a)
+		}
+	}
+	return
+}
+
+func containsAddress(addresses []netlink.Address, ip net.IP) bool {
+	for _, address := range addresses {
+		if address.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(addresses []net.IP, address net.IP) bool {
+	for _, a := range addresses {
+		if a.Equal(address) {
+			return true
+		}
+	}
+	return false
+}
+
+type EventType int
+
+const (
+	// EventStateChanged is sent on every supplicant state transition (scanning, authenticating,
+	// associating, 4way_handshake, completed, disconnected, ...).
+	EventStateChanged EventType = iota
+	// EventBSSChanged is sent when interface associates or roams to other BSS.
+	EventBSSChanged
+	// EventDisconnected carries reason of disconnection.
+	EventDisconnected
+	EventAddressAdded
+	EventAddressRemoved
+)
+
+func (self EventType) String() string {
+	switch self {
+	case EventStateChanged:
+		return "state_changed"
+	case EventBSSChanged:
+		return "bss_changed"
+	case EventDisconnected:
+		return "disconnected"
+	case EventAddressAdded:
+		return "address_added"
+	case EventAddressRemoved:
+		return "address_removed"
+	}
+	return "unknown"
+}
+
+type Event struct {
+	Type          EventType
+	NetInterface  string
+	State         string
+	PreviousState string
+	BSSID         string
+	SSID          string
+	Frequency     uint16
+	Disconnect    *DisconnectError
+	Address       net.IP
+}
+
+type watcher struct {
+	NetInterface     string
+	index            int
+	iface            *wpa_dbus.InterfaceWPA
+	netlink          *netlink.Conn
+	signals          chan *dbus.Signal
+	addressMessages  chan []netlink.Message
+	addressesLost    chan bool
+	events           chan Event
+	state            string
+	currentBSS       dbus.ObjectPath
+	disconnectReason int32
+	addresses        []net.IP
+}
@@ -0,0 +1,41 @@
+package wpaconnect
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestWatcherSyncAddresses(t *testing.T) {
+	loopback, err := net.InterfaceByName("lo")
+	if addresses, _ := loopback.Addrs(); err != nil || len(addresses) == 0 {
+		t.Skip("loopback interface has no addresses", err)
+	}
+	// Address added and address removed while notifications were lost
+	gone := net.IP{192, 0, 2, 99}
+	watcher := &watcher{NetInterface: "lo", index: loopback.Index, events: make(chan Event, 16),
+		addresses: []net.IP{gone}}
+	watcher.syncAddresses(context.Background())
+	close(watcher.events)
+	var added, removed []net.IP
+	for event := range watcher.events {
+		switch event.Type {
+		case EventAddressAdded:
+			added = append(added, event.Address)
+		case EventAddressRemoved:
+			removed = append(removed, event.Address)
+		}
+	}
+	if len(removed) != 1 || !removed[0].Equal(gone) {
+		t.Errorf("removed %v, want %v", removed, gone)
+	}
+	if !containsIP(added, net.IPv4(127, 0, 0, 1)) || containsIP(watcher.addresses, gone) {
+		t.Errorf("added %v, addresses %v", added, watcher.addresses)
+	}
+	// Known addresses are not reported again
+	watcher.events = make(chan Event, 16)
+	watcher.syncAddresses(context.Background())
+	if len(watcher.events) != 0 {
+		t.Errorf("got %d events for unchanged addresses", len(watcher.events))
+	}
+}
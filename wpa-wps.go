@@ -0,0 +1,217 @@
+package wpaconnect
+
+import (
+	"context"
+	"net"
+
+	"github.com/godbus/dbus"
+	"github.com/mark2b/wpa-connect/internal/log"
+	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
+)
+
+type WPSMethod int
+
+const (
+	WPSPushButton WPSMethod = iota
+	WPSPin
+)
+
+type WPSStage int
+
+const (
+	WPSStageStarted WPSStage = iota
+	WPSStageM2D
+	WPSStageCredentials
+	WPSStageSuccess
+	WPSStageConnected
+)
+
+func (self WPSStage) String() string {
+	switch self {
+	case WPSStageStarted:
+		return "started"
+	case WPSStageM2D:
+		return "m2d"
+	case WPSStageCredentials:
+		return "credentials"
+	case WPSStageSuccess:
+		return "success"
+	case WPSStageConnected:
+		return "connected"
+	}
+	return "unknown"
+}
+
+// WPSOptions selects WPS method. With WPSPin and empty PIN supplicant generates PIN, it is
+// reported in WPSStageStarted progress and has to be entered on access point. BSSID limits
+// negotiation to single access point. Persist saves learned network to configuration file.
+type WPSOptions struct {
+	Method     WPSMethod
+	PIN        string
+	BSSID      string
+	Persist    bool
+	OnProgress func(WPSProgress)
+}
+
+// WPSProgress is reported as negotiation advances. M2D means registrar answered but is not
+// ready to provide credentials, e.g. PIN was not entered yet.
+type WPSProgress struct {
+	Stage WPSStage
+	PIN   string
+	SSID  string
+}
+
+// WPSResult holds network and credentials learned from access point.
+type WPSResult struct {
+	ConnectionInfo
+	BSSID       string
+	PIN         string
+	AuthType    []string
+	Credentials Credentials
+}
+
+// ConnectWPS runs WPS negotiation and waits until supplicant connects with learned credentials
+// and address is acquired. Overlapping push-button sessions fail with ErrWPSOverlap, rejected
+// negotiation with WPSError, ctx deadline with ErrWPSTimeout or ErrWPSRegistrarNotReady.
+func (self *connectManager) ConnectWPS(ctx context.Context, options WPSOptions) (result WPSResult, e error) {
+	self.removeIPConfig()
+	self.context = &connectContext{}
+	if wpa, err := wpa_dbus.NewWPAWithContext(ctx); err == nil {
+		if wpa.ReadInterface(self.netInterface()); wpa.Error == nil {
+			iface := wpa.Interface
+			signals := make(chan *dbus.Signal, 16)
+			wpa.WaitForSignals(func(wpa *wpa_dbus.WPA, signal *dbus.Signal) {
+				if signal.Path == iface.Object.Path() {
+					forwardSignal(signals, signal, "WPS")
+				}
+			})
+			if iface.AddSignalsObserver().AddWPSSignalsObserver(); iface.Error == nil {
+				if iface.StartWPS(options.startArgs()); iface.Error == nil {
+					result.PIN = iface.WPSPin
+					options.progress(WPSProgress{Stage: WPSStageStarted, PIN: result.PIN})
+					if e = self.waitForWPS(ctx, signals, &options, &result); e == nil {
+						if e = self.configureAddress(ctx); e == nil && options.Persist {
+							e = saveConfig(iface)
+						}
+						if e == nil {
+							result.ConnectionInfo = self.connectionInfo(ctx, result.SSID)
+						}
+					} else if detached := iface.Detached(); detached.CancelWPS().Error != nil {
+						log.Log.Warning("Can't cancel WPS", detached.Error)
+					}
+				} else {
+					e = iface.Error
+				}
+			} else {
+				e = iface.Error
+			}
+			iface.RemoveWPSSignalsObserver()
+			iface.RemoveSignalsObserver()
+		} else {
+			e = wpa.Error
+		}
+		wpa.StopWaitForSignals()
+	} else {
+		e = err
+	}
+	if e != nil {
+		self.removeIPConfig()
+	}
+	return
+}
+
+// waitForWPS processes WPS signals until supplicant completes connection with learned credentials.
+func (self *connectManager) waitForWPS(ctx context.Context, signals chan *dbus.Signal, options *WPSOptions, result *WPSResult) (e error) {
+	var succeeded, m2d bool
+	for {
+		select {
+		case signal := <-signals:
+			switch signal.Name {
+			case "fi.w1.wpa_supplicant1.Interface.WPS.Credentials":
+				if len(signal.Body) > 0 {
+					if credentials, ok := signal.Body[0].(map[string]dbus.Variant); ok {
+						result.setCredentials(credentials)
+						options.progress(WPSProgress{Stage: WPSStageCredentials, SSID: result.SSID})
+					}
+				}
+			case "fi.w1.wpa_supplicant1.Interface.WPS.Event":
+				if len(signal.Body) < 2 {
+					continue
+				}
+				name, _ := signal.Body[0].(string)
+				args, _ := signal.Body[1].(map[string]dbus.Variant)
+				log.Log.Debug("WPS event", name, args)
+				switch name {
+				case "success":
+					succeeded = true
+					options.progress(WPSProgress{Stage: WPSStageSuccess, SSID: result.SSID})
+				case "m2d":
+					m2d = true
+					options.progress(WPSProgress{Stage: WPSStageM2D})
+				case "pbc-overlap":
+					return ErrWPSOverlap
+				case "fail":
+					wpsError := &WPSError{}
+					wpsError.Message, _ = args["msg"].Value().(int32)
+					wpsError.ConfigError, _ = args["config_error"].Value().(int32)
+					wpsError.ErrorIndication, _ = args["error_indication"].Value().(int32)
+					return wpsError
+				}
+			case "fi.w1.wpa_supplicant1.Interface.PropertiesChanged":
+				if len(signal.Body) > 0 && succeeded {
+					properties, _ := signal.Body[0].(map[string]dbus.Variant)
+					if state, ok := properties["State"].Value().(string); ok && state == "completed" {
+						options.progress(WPSProgress{Stage: WPSStageConnected, SSID: result.SSID})
+						return
+					}
+				}
+			}
+		case <-ctx.Done():
+			switch {
+			case succeeded:
+				return phaseError(ctx, ErrAssociationTimeout)
+			case m2d:
+				return phaseError(ctx, ErrWPSRegistrarNotReady)
+			default:
+				return phaseError(ctx, ErrWPSTimeout)
+			}
+		}
+	}
+}
+
+func (self *WPSOptions) startArgs() map[string]dbus.Variant {
+	args := map[string]dbus.Variant{"Role": dbus.MakeVariant("enrollee")}
+	if self.Method == WPSPin {
+		args["Type"] = dbus.MakeVariant("pin")
+		if self.PIN != "" {
+			args["Pin"] = dbus.MakeVariant(self.PIN)
+		}
+	} else {
+		args["Type"] = dbus.MakeVariant("pbc")
+	}
+	if bssid, err := net.ParseMAC(self.BSSID); err == nil {
+		args["Bssid"] = dbus.MakeVariant([]byte(bssid))
+	}
+	return args
+}
+
+func (self *WPSOptions) progress(progress WPSProgress) {
+	if self.OnProgress != nil {
+		self.OnProgress(progress)
+	}
+}
+
+func (self *WPSResult) setCredentials(credentials map[string]dbus.Variant) {
+	if value, ok := credentials["SSID"].Value().([]byte); ok {
+		self.SSID = string(value)
+	}
+	if value, ok := credentials["BSSID"].Value().([]byte); ok {
+		self.BSSID = net.HardwareAddr(value).String()
+	}
+	if value, ok := credentials["AuthType"].Value().([]string); ok {
+		self.AuthType = value
+	}
+	if value, ok := credentials["Key"].Value().([]byte); ok {
+		self.Credentials = Credentials{Password: string(value)}
+	}
+}
@@ -1,6 +1,12 @@
 package wpaconnect
 
-import "github.com/mark2b/wpa-connect/internal/log"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mark2b/wpa-connect/internal/log"
+	"github.com/mark2b/wpa-connect/internal/wpa_dbus"
+)
 
 func SetSilentMode() {
 	log.SetSilentMode()
@@ -17,3 +23,31 @@ func SetVerboseMode() {
 func SetDebugMode() {
 	log.SetDebugMode()
 }
+
+// withInterface runs callBack on supplicant interface of netInterface.
+func withInterface(netInterface string, callBack func(*wpa_dbus.InterfaceWPA) error) (e error) {
+	if wpa, err := wpa_dbus.NewWPA(); err == nil {
+		if wpa.ReadInterface(netInterface); wpa.Error == nil {
+			e = callBack(wpa.Interface)
+		} else {
+			e = wpa.Error
+		}
+	} else {
+		e = err
+	}
+	return
+}
+
+// saveConfig writes supplicant configuration file. Supplicant refuses it unless
+// configuration file has update_config=1.
+func saveConfig(iface *wpa_dbus.InterfaceWPA) (e error) {
+	if iface.SaveConfig(); iface.Error != nil {
+		if strings.Contains(iface.Error.Error(), "update_config") {
+			e = fmt.Errorf("%w, %s", ErrSaveConfigNotAllowed, iface.Error)
+		} else {
+			e = iface.Error
+		}
+		iface.Error = nil
+	}
+	return
+}